@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/anonymize"
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/extjson"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+	"github.com/flowHater/mongo-inferer/pkg/seeder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// keyEnv holds the secret keying the replacements when -key is not given
+const keyEnv = "ANONYMIZE_KEY"
+
+// source is what anonymize reads from, it lists the collections and streams the documents
+type source interface {
+	discover.Fetcher
+	anonymize.Scanner
+}
+
+func main() {
+	db := flag.String("db", "", "database to export")
+	configFile := flag.String("config", "", "YAML or JSON file giving by collection the kind of the fields to pseudonymise: email, name, text, hash, null, or id for the references to _ids that aren't ObjectIds")
+	key := flag.String("key", "", "secret keying the replacements, exports with the same key match. $"+keyEnv+" or a random key when empty")
+	dir := flag.String("dir", "", "read mongoexport files laid out as <dir>/<db>/<collection>.json instead of MongoDB")
+	outDir := flag.String("out-dir", "", "write files laid out as <dir>/<db>/<collection>")
+	outFormat := flag.String("out-format", seeder.FormatNDJSON, "format of the -out-dir files: ndjson or bson")
+	outDB := flag.String("out-db", "", "insert into this MongoDB database instead of writing files")
+	read := mongoflags.RegisterRead(flag.CommandLine)
+	conn := mongoflags.RegisterClient(flag.CommandLine)
+	flag.Parse()
+
+	if *db == "" || (*outDir == "") == (*outDB == "") {
+		log.Fatalln("-db and exactly one of -out-dir and -out-db are required")
+	}
+	if *dir == "" && *outDB == *db {
+		log.Fatalln("-out-db can't be the exported database")
+	}
+
+	config := &anonymize.Config{}
+	if *configFile != "" {
+		f, err := os.Open(*configFile)
+		if err != nil {
+			log.Fatalf("Error during opening config %s: %s", *configFile, err)
+		}
+		config, err = anonymize.LoadConfig(f)
+		f.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if *key == "" {
+		*key = os.Getenv(keyEnv)
+	}
+
+	readOpts, err := read.RepositoryOptions()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	var client *mongo.Client
+	if *dir == "" || *outDB != "" {
+		clientOpts, err := conn.Options()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		client, err = mongo.Connect(ctx, clientOpts)
+		if err != nil {
+			log.Fatalf("An error occured during mongodb client's initialization")
+		}
+	}
+
+	var src source
+	if *dir != "" {
+		src = extjson.NewFetcher(*dir, 0)
+	} else {
+		src = discover.NewRepository(append(readOpts, discover.RepositoryWithClient(client))...)
+	}
+
+	a, err := anonymize.New(config, anonymize.WithKey([]byte(*key)))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	collections, err := src.ListCollections(ctx, *db)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var sink seeder.Sink
+	if *outDir != "" {
+		sink, err = seeder.NewFileSink(*outDir, *db, *outFormat)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	} else {
+		// The sink skips the _ids already there, an export into a used database would keep its documents
+		names, err := client.Database(*outDB).ListCollectionNames(ctx, bson.D{})
+		if err != nil {
+			log.Fatalf("Error during listing the collections of -out-db %s: %s", *outDB, err)
+		}
+		if len(names) > 0 {
+			log.Fatalf("-out-db %s isn't empty, it has the collections %s", *outDB, strings.Join(names, ", "))
+		}
+
+		sink = seeder.NewMongoSink(ctx, client.Database(*outDB))
+	}
+
+	if err := anonymize.Export(ctx, src, *db, collections, a, sink); err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("%d collections exported\n", len(collections))
+}
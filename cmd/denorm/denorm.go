@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/flowHater/mongo-inferer/pkg/denorm"
+	"github.com/flowHater/mongo-inferer/pkg/linkfile"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+)
+
+func main() {
+	db := flag.String("db", "", "database to scan")
+	sample := flag.Int("sample", 1000, "number of documents of each collection compared with the documents they reference")
+	linksFile := flag.String("links", "", "read the links from this output of inferer -output json instead of discovering them")
+	dir := flag.String("dir", "", "read mongoexport files laid out as <dir>/<db>/<collection>.json instead of MongoDB")
+	format := flag.String("format", "text", "format of the report: text (with the sync pipelines) or json")
+	read := mongoflags.RegisterRead(flag.CommandLine)
+	conn := mongoflags.RegisterClient(flag.CommandLine)
+	flag.Parse()
+
+	if *db == "" {
+		log.Fatalln("-db is required")
+	}
+
+	ctx := context.Background()
+	src, err := linkfile.Open(ctx, *dir, read, conn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	links, err := linkfile.Read(ctx, src, *db, *linksFile, linkfile.WarnPartial)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	cs, err := denorm.Detect(ctx, src, *db, links, *sample)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *format {
+	case "text":
+		err = denorm.Write(os.Stdout, *db, cs)
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(cs)
+	default:
+		err = fmt.Errorf("Unknown format %q, expected text or json", *format)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
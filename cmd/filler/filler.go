@@ -2,19 +2,133 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/flowHater/mongo-inferer/pkg/codegen"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
 	"github.com/flowHater/mongo-inferer/pkg/seeder"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func main() {
+	// filler [seed|reset|drop] [flags], seed when no command is given
+	cmd, args := "seed", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	if cmd != "seed" && cmd != "reset" && cmd != "drop" {
+		log.Fatalf("Unknown command %q, expected seed, reset (drop then seed) or drop", cmd)
+	}
+
+	fs := flag.NewFlagSet("filler "+cmd, flag.ExitOnError)
+	specFile := fs.String("spec", "", "YAML or JSON file describing the dataset, the small A/B/C dataset when empty")
+	from := fs.String("from", "", "generate look-alike data from this output of inferer -output model instead of -spec")
+	scale := fs.Float64("scale", 1, "with -from, number of documents generated per sampled document")
+	db := fs.String("db", "", "database of the spec's collections instead of the one of the spec or of the model")
+	var outDir, outFormat *string
+	if cmd == "seed" {
+		outDir = fs.String("out-dir", "", "write files laid out as <dir>/<db>/<collection> instead of inserting into MongoDB")
+		outFormat = fs.String("out-format", seeder.FormatNDJSON, "format of the -out-dir files: ndjson or bson")
+	}
+	batchSize := 1000
+	if cmd != "drop" {
+		fs.IntVar(&batchSize, "batch-size", batchSize, "number of documents sent by each InsertMany")
+	}
+	conn := mongoflags.RegisterClient(fs)
+	fs.Parse(args)
+
+	spec, err := loadSpec(*specFile, *from, *scale)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if *db != "" {
+		spec.Database = *db
+	}
+
+	if outDir != nil && *outDir != "" {
+		g, err := seeder.NewGenerator(spec)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		sink, err := seeder.NewFileSink(*outDir, spec.Database, *outFormat)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		if err := seeder.Run(g, sink); err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Println("Files written")
+		return
+	}
+
 	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	clientOpts, err := conn.Options()
+	if err != nil {
+		log.Fatalln(err)
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		log.Fatalf("An error occured during mongodb client's initialization")
 	}
 
-	seeder.Seed(ctx, client)
+	if cmd == "drop" {
+		if err := seeder.Drop(ctx, client, spec); err != nil {
+			log.Fatalln(err)
+		}
+
+		fmt.Println("Collections dropped")
+		return
+	}
+
+	opts := []seeder.SeedOptionF{seeder.SeedWithBatchSize(batchSize)}
+	if cmd == "reset" {
+		opts = append(opts, seeder.SeedWithReset())
+	}
+	skipped, err := seeder.Seed(ctx, client, spec, opts...)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if skipped > 0 {
+		fmt.Printf("Database filled, %d documents were skipped because their _id already existed\n", skipped)
+		return
+	}
+	fmt.Println("Database filled")
+}
+
+// loadSpec reads the spec given by the flags
+func loadSpec(specFile, from string, scale float64) (*seeder.Spec, error) {
+	switch {
+	case specFile != "" && from != "":
+		return nil, fmt.Errorf("-spec and -from can't be used together")
+	case specFile != "":
+		f, err := os.Open(specFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error during opening spec %s: %w", specFile, err)
+		}
+		defer f.Close()
+
+		return seeder.LoadSpec(f)
+	case from != "":
+		f, err := os.Open(from)
+		if err != nil {
+			return nil, fmt.Errorf("Error during opening model %s: %w", from, err)
+		}
+		defer f.Close()
+
+		m := codegen.Model{}
+		if err := json.NewDecoder(f).Decode(&m); err != nil {
+			return nil, fmt.Errorf("Error during reading model %s: %w", from, err)
+		}
+
+		return seeder.SpecFromInference(m.DB, m.Schemas, m.Links, scale), nil
+	default:
+		return seeder.DefaultSpec(), nil
+	}
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/impact"
+	"github.com/flowHater/mongo-inferer/pkg/linkfile"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func main() {
+	target := flag.String("target", "", "db.collection of the document about to be deleted")
+	id := flag.String("id", "", "_id of the document about to be deleted, as an hexadecimal ObjectId")
+	depth := flag.Int("depth", 3, "how many levels of references to follow")
+	batchSize := flag.Int("batch-size", 1000, "number of IDs looked up by each query")
+	linksFile := flag.String("links", "", "read the links from this output of inferer -output json instead of discovering them")
+	dir := flag.String("dir", "", "read mongoexport files laid out as <dir>/<db>/<collection>.json instead of MongoDB")
+	ops := flag.String("ops", "", "also print the commands of a cascade, without running them: delete or unset")
+	format := flag.String("format", "text", "format of the impact tree: text or json")
+	read := mongoflags.RegisterRead(flag.CommandLine)
+	conn := mongoflags.RegisterClient(flag.CommandLine)
+	flag.Parse()
+
+	i := strings.Index(*target, ".")
+	if i <= 0 || i == len(*target)-1 {
+		log.Fatalf("-target must be db.collection, got %q", *target)
+	}
+	db := (*target)[:i]
+
+	oid, err := primitive.ObjectIDFromHex(*id)
+	if err != nil {
+		log.Fatalf("Error during parsing -id %q: %s", *id, err)
+	}
+
+	if *ops != "" {
+		if err := impact.Mode(*ops).Validate(); err != nil {
+			log.Fatalf("Error during parsing -ops: %s", err)
+		}
+	}
+
+	ctx := context.Background()
+	src, err := linkfile.Open(ctx, *dir, read, conn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	links, err := linkfile.Read(ctx, src, db, *linksFile, linkfile.WarnPartial)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	root, err := impact.NewAnalyzer(src, db, links, impact.WithBatchSize(*batchSize)).Impact(ctx, *target, oid, *depth)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *format {
+	case "text":
+		err = impact.Print(os.Stdout, root)
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(root)
+	default:
+		err = fmt.Errorf("Unknown format %q, expected text or json", *format)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *ops == "" {
+		return
+	}
+
+	cmds, err := impact.Operations(root, impact.Mode(*ops))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	fmt.Printf("\n// Dry run of a cascade %s, nothing was executed:\n", *ops)
+	for _, c := range cmds {
+		fmt.Println(c)
+	}
+}
@@ -2,30 +2,252 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"crypto/rand"
+	"errors"
+	"flag"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/flowHater/mongo-inferer/pkg/codegen"
 	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/extjson"
+	"github.com/flowHater/mongo-inferer/pkg/metrics"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+	"github.com/flowHater/mongo-inferer/pkg/replay"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
 	"github.com/flowHater/mongo-inferer/pkg/seeder"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func main() {
-	ctx := context.Background()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI("mongodb://localhost:27017"))
+	db := flag.String("db", seeder.Database, "database to scan")
+	dir := flag.String("dir", "", "read mongoexport files laid out as <dir>/<db>/<collection>.json instead of MongoDB")
+	replayFile := flag.String("replay", "", "answer with the calls recorded in this file instead of MongoDB")
+	recordFile := flag.String("record", "", "record every call to MongoDB and its response to this file")
+	redact := flag.Bool("redact", false, "hash ObjectIds and strip all values from the -record file")
+	output := flag.String("output", "json", "what to print: json (links), model (links and schemas, for filler -from), go (structs), ts (interfaces), mongoose (schemas), sql (PostgreSQL DDL), indexes (missing indexes), graph (cycles, roots, load order), modeling (embedded vs referenced review), arrays (growth of reference arrays), lookup or lookup-go ($lookup pipeline of -lookup-collection)")
+	goPackage := flag.String("go-package", "models", "package of the generated Go code")
+	progress := flag.Bool("progress", isTerminal(os.Stderr), "draw a progress bar on stderr during the scan, by default when stderr is a terminal")
+	events := flag.String("events", "", "write scan events as JSON lines to this file, - for stderr")
+	logLevel := flag.String("log-level", "info", "minimum level of logs: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "format of logs written on stderr: text or json")
+	attempts := flag.Int("retries", 4, "number of attempts of each call to MongoDB before giving up, 1 disables retries")
+	timeout := flag.Duration("timeout", 30*time.Second, "deadline of each call to MongoDB, 0 disables it")
+	checkpoint := flag.String("checkpoint", "", "save the result of each collection and the ID cache to this file")
+	resume := flag.Bool("resume", false, "skip the collections already completed in the -checkpoint file")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+	metricsLinger := flag.Duration("metrics-linger", 30*time.Second, "keep serving -metrics-addr this long after the scan so the final values get scraped")
+	lookupCollection := flag.String("lookup-collection", "", "collection whose links the lookup outputs populate")
+	lookupDepth := flag.Int("lookup-depth", 1, "how many levels of links the lookup outputs populate")
+	embeddedIDMisses := flag.Float64("embedded-id-misses", 0.2, "share of the sampled documents whose sub-document _id at a path may match no collection before the path is no longer probed, 1 always probes")
+	maxArrayLength := flag.Int("max-array-length", 100, "array length from which the modeling output flags an array as unbounded")
+	arrayScan := flag.Bool("array-scan", false, "with -output arrays, also measure the arrays of the whole collections with a $size aggregation")
+	arrayWarning := flag.Int("array-warning", 1000, "array length from which the arrays output warns")
+	arrayCritical := flag.Int("array-critical", 10000, "array length from which the arrays output is critical")
+	read := mongoflags.RegisterRead(flag.CommandLine)
+	conn := mongoflags.RegisterClient(flag.CommandLine)
+	flag.Parse()
+
+	if *replayFile != "" && *dir != "" {
+		log.Fatalln("-replay and -dir can't be used together")
+	}
+
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
 	if err != nil {
-		log.Fatalf("An error occured during mongodb client's initialization")
+		log.Fatalln(err)
+	}
+
+	ctx := context.Background()
+	observers := []discover.Observer{}
+	if *progress {
+		observers = append(observers, newProgressBar(os.Stderr))
+	}
+
+	switch *events {
+	case "":
+	case "-":
+		observers = append(observers, discover.NewJSONObserver(os.Stderr))
+	default:
+		f, err := os.Create(*events)
+		if err != nil {
+			log.Fatalf("Error during creating events file %s: %s", *events, err)
+		}
+		defer f.Close()
+
+		observers = append(observers, discover.NewJSONObserver(f))
+	}
+
+	// source identifies where the documents come from in the checkpoint
+	var source string
+	var r discover.Fetcher
+	if *replayFile != "" {
+		source = "replay " + *replayFile
+		f, err := os.Open(*replayFile)
+		if err != nil {
+			log.Fatalf("Error during opening recording %s: %s", *replayFile, err)
+		}
+
+		r, err = replay.NewReplayer(f)
+		f.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	} else if *dir != "" {
+		source = "dir " + *dir
+		r = extjson.NewFetcher(*dir, 0)
+	} else {
+		readOpts, err := read.RepositoryOptions()
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		clientOpts, err := conn.Options()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		source = "mongodb://" + strings.Join(clientOpts.Hosts, ",")
+		client, err := mongo.Connect(ctx, clientOpts)
+		if err != nil {
+			log.Fatalf("An error occured during mongodb client's initialization")
+		}
+
+		r = discover.NewRepository(append(readOpts, discover.RepositoryWithClient(client))...)
+	}
+
+	var recorder *replay.Recorder
+	if *recordFile != "" {
+		f, err := os.Create(*recordFile)
+		if err != nil {
+			log.Fatalf("Error during creating recording %s: %s", *recordFile, err)
+		}
+		defer f.Close()
+
+		opts := []replay.RecorderOptionF{}
+		if *redact {
+			salt := make([]byte, 32)
+			if _, err := rand.Read(salt); err != nil {
+				log.Fatalf("Error during generating redaction salt: %s", err)
+			}
+			opts = append(opts, replay.RecorderWithRedaction(salt))
+		}
+
+		recorder = replay.NewRecorder(r, f, opts...)
+		r = recorder
+	}
+
+	var metricsServer *http.Server
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(prometheus.NewGoCollector(), prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}))
+		m, err := metrics.New(reg)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		r = m.Fetcher(r)
+		observers = append(observers, m)
+		metricsServer = serveMetrics(*metricsAddr, reg, logger)
 	}
+	r = discover.NewRetryFetcher(r, discover.RetryWithAttempts(*attempts), discover.RetryWithTimeout(*timeout))
 
-	r := discover.NewRepository(discover.RepositoryWithClient(client))
-	d := discover.New(ctx, r)
+	collector := schema.NewCollector()
 
-	m, err := d.Database(ctx, seeder.Database)
+	opts := []discover.OptionF{
+		discover.WithObserver(discover.Observers(observers...)),
+		discover.WithSampleObserver(collector),
+		discover.WithLogger(logger),
+		discover.WithEmbeddedIDMisses(*embeddedIDMisses),
+	}
+	if *checkpoint != "" {
+		c, err := discover.OpenCheckpoint(*checkpoint, discover.CheckpointKey{Source: source, Database: *db}, *resume)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		defer c.Close()
+		opts = append(opts, discover.WithCheckpoint(c))
+	} else if *resume {
+		log.Fatalln("-resume requires -checkpoint")
+	}
+
+	d, err := discover.New(ctx, r, opts...)
 	if err != nil {
 		log.Fatalln(err)
 	}
-	jm, err := json.Marshal(m)
-	fmt.Println(string(jm))
+
+	m, err := d.Database(ctx, *db)
+	var scanErr *discover.ScanError
+	if err != nil && !errors.As(err, &scanErr) {
+		log.Fatalln(err)
+	}
+	model := codegen.Model{DB: *db, Schemas: collector.Database(*db), Links: m}
+	if err := writeOutput(ctx, os.Stdout, outputOptions{
+		format:           *output,
+		goPackage:        *goPackage,
+		lookupCollection: *lookupCollection,
+		lookupDepth:      *lookupDepth,
+		maxArrayLength:   *maxArrayLength,
+		arrayScan:        *arrayScan,
+		arrayWarning:     *arrayWarning,
+		arrayCritical:    *arrayCritical,
+	}, r, model); err != nil {
+		log.Fatalln(err)
+	}
+
+	if recorder != nil && recorder.Err() != nil {
+		logger.Error("Recording is incomplete", "file", *recordFile, "err", recorder.Err())
+	}
+
+	if metricsServer != nil {
+		lingerMetrics(metricsServer, *metricsLinger, logger)
+	}
+
+	if scanErr != nil {
+		for _, f := range scanErr.Failures {
+			logger.Error("Collection failed", "db", scanErr.Database, "collection", f.Collection, "err", f.Err)
+		}
+		os.Exit(1)
+	}
+}
+
+// serveMetrics exposes the metrics of reg on addr in the background
+func serveMetrics(addr string, reg *prometheus.Registry, logger *slog.Logger) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Error during serving metrics", "addr", addr, "err", err)
+		}
+	}()
+
+	return srv
+}
+
+// lingerMetrics keeps srv up for d so a last scrape sees the final values, an interrupt cuts it short
+func lingerMetrics(srv *http.Server, d time.Duration, logger *slog.Logger) {
+	if d > 0 {
+		logger.Info("Serving final metrics", "addr", srv.Addr, "for", d)
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		select {
+		case <-time.After(d):
+		case <-sig:
+		}
+		signal.Stop(sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Error("Error during stopping metrics server", "addr", srv.Addr, "err", err)
+	}
 }
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	tests := []struct {
+		name    string
+		level   string
+		format  string
+		want    string
+		wantErr bool
+	}{
+		{name: "text", level: "info", format: "text", want: `level=INFO msg=kept db=shop`},
+		{name: "json", level: "INFO", format: "JSON", want: `"msg":"kept"`},
+		{name: "debug shows everything", level: "debug", format: "text", want: `msg=dropped`},
+		{name: "unknown level", level: "verbose", format: "text", wantErr: true},
+		{name: "unknown format", level: "info", format: "xml", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			l, err := newLogger(&b, tt.level, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newLogger() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			l.Debug("dropped")
+			l.Info("kept", "db", "shop")
+			if !strings.Contains(b.String(), tt.want) {
+				t.Errorf("logs = %s, want %s", b.String(), tt.want)
+			}
+			if tt.level != "debug" && strings.Contains(b.String(), "dropped") {
+				t.Errorf("logs = %s, want debug dropped at level %s", b.String(), tt.level)
+			}
+			if strings.EqualFold(tt.format, "json") && !json.Valid(bytes.TrimSpace(b.Bytes())) {
+				t.Errorf("logs = %s, want a JSON line", b.String())
+			}
+		})
+	}
+}
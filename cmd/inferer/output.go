@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/flowHater/mongo-inferer/pkg/advisor"
+	"github.com/flowHater/mongo-inferer/pkg/codegen"
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/graph"
+	"github.com/flowHater/mongo-inferer/pkg/growth"
+	"github.com/flowHater/mongo-inferer/pkg/modeling"
+)
+
+// outputOptions are the flags shaping the output
+type outputOptions struct {
+	format           string
+	goPackage        string
+	lookupCollection string
+	lookupDepth      int
+	maxArrayLength   int
+	arrayScan        bool
+	arrayWarning     int
+	arrayCritical    int
+}
+
+// writeOutput prints the result of the scan in the format asked with -output, r is only asked for the indexes and the array lengths
+func writeOutput(ctx context.Context, w io.Writer, o outputOptions, r discover.Fetcher, m codegen.Model) error {
+	switch o.format {
+	case "json":
+		jm, err := json.Marshal(m.Links)
+		if err != nil {
+			return fmt.Errorf("Error during encoding links: %w", err)
+		}
+
+		_, err = fmt.Fprintln(w, string(jm))
+		return err
+	case "model":
+		jm, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("Error during encoding model: %w", err)
+		}
+
+		_, err = fmt.Fprintln(w, string(jm))
+		return err
+	case "go":
+		return codegen.Go(w, o.goPackage, m)
+	case "ts":
+		return codegen.TypeScript(w, m)
+	case "mongoose":
+		return codegen.Mongoose(w, m)
+	case "sql":
+		return codegen.Postgres(w, m)
+	case "indexes":
+		l, ok := r.(discover.IndexLister)
+		if !ok {
+			return fmt.Errorf("-output indexes needs a source knowing the indexes: %w", discover.ErrUnsupported)
+		}
+
+		rs, err := advisor.Recommend(ctx, l, m.DB, m.Links)
+		if err != nil {
+			return err
+		}
+
+		return advisor.Write(w, m.DB, rs)
+	case "graph":
+		jr, err := json.Marshal(graph.New(m.DB, m.Links).Report())
+		if err != nil {
+			return fmt.Errorf("Error during encoding graph: %w", err)
+		}
+
+		_, err = fmt.Fprintln(w, string(jr))
+		return err
+	case "modeling":
+		return modeling.Write(w, modeling.Review(m.Schemas, m.Links, modeling.WithMaxLength(o.maxArrayLength)))
+	case "arrays":
+		opts := []growth.OptionF{growth.WithThresholds(o.arrayWarning, o.arrayCritical)}
+		if o.arrayScan {
+			c, ok := r.(discover.ArrayCounter)
+			if !ok {
+				return fmt.Errorf("-array-scan needs a source able to scan whole collections: %w", discover.ErrUnsupported)
+			}
+			opts = append(opts, growth.WithScan(c))
+		}
+
+		arrays, err := growth.Analyze(ctx, m.DB, m.Schemas, m.Links, opts...)
+		if err != nil {
+			return err
+		}
+
+		return growth.Write(w, m.DB, arrays)
+	case "lookup":
+		return codegen.LookupJSON(w, m, o.lookupCollection, o.lookupDepth)
+	case "lookup-go":
+		return codegen.LookupGo(w, o.goPackage, m, o.lookupCollection, o.lookupDepth)
+	default:
+		return fmt.Errorf("Unknown output %q", o.format)
+	}
+}
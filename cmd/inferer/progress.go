@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+const (
+	progressWidth   = 30
+	progressRefresh = 100 * time.Millisecond
+)
+
+// progressBar is a discover.Observer drawing a single line progress bar on a terminal
+type progressBar struct {
+	mu       sync.Mutex
+	w        io.Writer
+	total    int
+	done     int
+	probed   int
+	hits     int
+	unknown  int
+	errors   int
+	lastDraw time.Time
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w}
+}
+
+// Notify updates the counters and redraws the bar, id level events are throttled
+func (p *progressBar) Notify(e discover.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	force := false
+	switch e.Type {
+	case discover.EventScanStarted:
+		p.total = e.Count
+		force = true
+	case discover.EventCollectionFinished, discover.EventCollectionResumed:
+		p.done++
+		force = true
+	case discover.EventIDProbed:
+		p.probed++
+	case discover.EventCacheHit:
+		p.hits++
+	case discover.EventUnknownOID:
+		p.unknown++
+	case discover.EventError:
+		p.errors++
+	case discover.EventScanFinished:
+		p.draw()
+		fmt.Fprintln(p.w)
+		return
+	}
+
+	if force || time.Since(p.lastDraw) > progressRefresh {
+		p.draw()
+	}
+}
+
+func (p *progressBar) draw() {
+	p.lastDraw = time.Now()
+
+	filled := 0
+	if p.total > 0 {
+		filled = progressWidth * p.done / p.total
+	}
+
+	fmt.Fprintf(p.w, "\r[%s%s] %d/%d collections | %d ids probed | %d cache hits | %d unknown | %d errors",
+		strings.Repeat("#", filled), strings.Repeat(" ", progressWidth-filled),
+		p.done, p.total, p.probed, p.hits, p.unknown, p.errors,
+	)
+}
+
+// isTerminal tells whether f is a terminal, the bar's carriage returns would clutter a file or a CI log
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+func TestProgressBar(t *testing.T) {
+	var b bytes.Buffer
+	p := newProgressBar(&b)
+
+	events := []discover.Event{
+		{Type: discover.EventScanStarted, Count: 4},
+		{Type: discover.EventCollectionResumed},
+		{Type: discover.EventIDProbed},
+		{Type: discover.EventIDProbed},
+		{Type: discover.EventCacheHit},
+		{Type: discover.EventUnknownOID},
+		{Type: discover.EventError, Err: errors.New("boom")},
+		{Type: discover.EventCollectionFinished},
+		{Type: discover.EventScanFinished},
+	}
+	for _, e := range events {
+		p.Notify(e)
+	}
+
+	frames := strings.Split(b.String(), "\r")
+	last := frames[len(frames)-1]
+	want := "[###############               ] 2/4 collections | 2 ids probed | 1 cache hits | 1 unknown | 1 errors\n"
+	if last != want {
+		t.Errorf("last frame = %q, want %q", last, want)
+	}
+	if !strings.HasPrefix(frames[1], "[                              ] 0/4 collections") {
+		t.Errorf("first frame = %q, want an empty bar", frames[1])
+	}
+}
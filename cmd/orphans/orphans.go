@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/flowHater/mongo-inferer/pkg/linkfile"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+	"github.com/flowHater/mongo-inferer/pkg/orphan"
+)
+
+func main() {
+	db := flag.String("db", "", "database to scan")
+	batchSize := flag.Int("batch-size", 1000, "number of IDs looked up by each query")
+	samples := flag.Int("samples", 10, "number of orphans listed by collection")
+	linksFile := flag.String("links", "", "read the links from this output of inferer -output json instead of discovering them")
+	dir := flag.String("dir", "", "read mongoexport files laid out as <dir>/<db>/<collection>.json instead of MongoDB")
+	format := flag.String("format", "text", "format of the report: text or json")
+	read := mongoflags.RegisterRead(flag.CommandLine)
+	conn := mongoflags.RegisterClient(flag.CommandLine)
+	flag.Parse()
+
+	if *db == "" {
+		log.Fatalln("-db is required")
+	}
+
+	ctx := context.Background()
+	src, err := linkfile.Open(ctx, *dir, read, conn)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	links, err := linkfile.Read(ctx, src, *db, *linksFile, linkfile.WarnPartial)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	rs, err := orphan.Find(ctx, src, *db, links, orphan.WithBatchSize(*batchSize), orphan.WithSamples(*samples))
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	switch *format {
+	case "text":
+		err = orphan.Write(os.Stdout, *db, rs)
+	case "json":
+		err = json.NewEncoder(os.Stdout).Encode(rs)
+	default:
+		err = fmt.Errorf("Unknown format %q, expected text or json", *format)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
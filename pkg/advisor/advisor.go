@@ -0,0 +1,160 @@
+package advisor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+// Recommendation is a link that no existing index can serve
+type Recommendation struct {
+	Collection string
+	// Path is the dotted path to index, the array markers of the link path are dropped so it's a multikey index
+	Path     string
+	LinkPath string
+	With     []string
+	Multikey bool
+	// EstimatedCount is the number of documents of the collection, what building the index will go through
+	EstimatedCount int64
+}
+
+// Command returns the mongo shell command creating the missing index
+func (r Recommendation) Command() string {
+	c, _ := json.Marshal(r.Collection)
+	p, _ := json.Marshal(r.Path)
+
+	return fmt.Sprintf("db.getCollection(%s).createIndex({ %s: 1 })", c, p)
+}
+
+// Recommend lists the indexes of every collection of links in db and returns the links they don't cover,
+// the biggest collections first.
+// An index covers a link when the link path is its first key, since only a prefix of an index can be used
+func Recommend(ctx context.Context, f discover.IndexLister, db string, links map[string]discover.CollectionLinks) ([]Recommendation, error) {
+	rs := []Recommendation{}
+
+	for c, cl := range links {
+		if len(cl) == 0 {
+			continue
+		}
+
+		indexes, err := f.ListIndexes(ctx, db, c)
+		if err != nil {
+			return nil, fmt.Errorf("Error during listing indexes of %s.%s: %w", db, c, err)
+		}
+
+		prefixes := map[string]struct{}{}
+		for _, i := range indexes {
+			if keys := discover.IndexKeys(i); len(keys) > 0 {
+				prefixes[keys[0].Key] = struct{}{}
+			}
+		}
+
+		// Links like xIds and xIds.$ share their dotted path, one index serves both
+		missing := []Recommendation{}
+		byPath := map[string]int{}
+		for _, lp := range sortedPaths(cl) {
+			l := cl[lp]
+			p := discover.DotPath(l.Path)
+			if _, ok := prefixes[p]; ok {
+				continue
+			}
+
+			if i, ok := byPath[p]; ok {
+				missing[i].With = mergeWith(missing[i].With, l.With)
+				missing[i].Multikey = missing[i].Multikey || p != l.Path
+				continue
+			}
+
+			byPath[p] = len(missing)
+			missing = append(missing, Recommendation{
+				Collection: c,
+				Path:       p,
+				LinkPath:   l.Path,
+				With:       l.With,
+				Multikey:   p != l.Path,
+			})
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		count, err := f.EstimatedCount(ctx, db, c)
+		if err != nil {
+			return nil, fmt.Errorf("Error during counting documents of %s.%s: %w", db, c, err)
+		}
+
+		for _, r := range missing {
+			r.EstimatedCount = count
+			rs = append(rs, r)
+		}
+	}
+
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].EstimatedCount != rs[j].EstimatedCount {
+			return rs[i].EstimatedCount > rs[j].EstimatedCount
+		}
+		if rs[i].Collection != rs[j].Collection {
+			return rs[i].Collection < rs[j].Collection
+		}
+
+		return rs[i].Path < rs[j].Path
+	})
+
+	return rs, nil
+}
+
+// sortedPaths returns the link paths of cl in order, a merged recommendation keeps the first one
+func sortedPaths(cl discover.CollectionLinks) []string {
+	ps := make([]string, 0, len(cl))
+	for p := range cl {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+
+	return ps
+}
+
+// mergeWith returns the sorted union of the collections of a and b
+func mergeWith(a, b []string) []string {
+	seen := map[string]bool{}
+	with := []string{}
+	for _, w := range append(append([]string{}, a...), b...) {
+		if !seen[w] {
+			seen[w] = true
+			with = append(with, w)
+		}
+	}
+	sort.Strings(with)
+
+	return with
+}
+
+// Write prints rs as a mongo shell script, every command preceded by why it's needed
+func Write(w io.Writer, db string, rs []Recommendation) error {
+	var b strings.Builder
+	if len(rs) == 0 {
+		fmt.Fprintf(&b, "// Every link of %s is served by an index.\n", db)
+	} else {
+		d, _ := json.Marshal(db)
+		fmt.Fprintf(&b, "// %d missing indexes on %s, the biggest collections first.\n", len(rs), db)
+		fmt.Fprintf(&b, "db = db.getSiblingDB(%s);\n", d)
+	}
+
+	for _, r := range rs {
+		kind := ""
+		if r.Multikey {
+			kind = " (multikey)"
+		}
+
+		fmt.Fprintf(&b, "\n// %s.%s references %s, ~%d documents%s\n", r.Collection, r.LinkPath, strings.Join(r.With, " or "), r.EstimatedCount, kind)
+		fmt.Fprintf(&b, "%s;\n", r.Command())
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
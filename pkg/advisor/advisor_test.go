@@ -0,0 +1,55 @@
+package advisor
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRecommend(t *testing.T) {
+	ctx := context.Background()
+	f := inmem.New(0).
+		Insert("db", "A", primitive.M{"_id": primitive.NewObjectID()}).
+		Insert("db", "B", primitive.M{"_id": primitive.NewObjectID()}, primitive.M{"_id": primitive.NewObjectID()}).
+		CreateIndex("db", "B", "aId_1_createdAt_1", primitive.D{{Key: "aId", Value: int32(1)}, {Key: "createdAt", Value: int32(1)}}).
+		CreateIndex("db", "B", "createdAt_1_cId_1", primitive.D{{Key: "createdAt", Value: int32(1)}, {Key: "cId", Value: int32(1)}})
+
+	links := map[string]discover.CollectionLinks{
+		"A": {"items.$.bId": {Path: "items.$.bId", With: []string{"db.B"}}},
+		"B": {
+			"aId": {Path: "aId", With: []string{"db.A"}},
+			"cId": {Path: "cId", With: []string{"db.C"}},
+			// Both paths are served by the multikey index on dIds
+			"dIds":   {Path: "dIds", With: []string{"db.D"}},
+			"dIds.$": {Path: "dIds.$", With: []string{"db.A", "db.D"}},
+		},
+	}
+
+	got, err := Recommend(ctx, f, "db", links)
+	if err != nil {
+		t.Fatalf("Recommend() error = %v", err)
+	}
+
+	want := []Recommendation{
+		{Collection: "B", Path: "cId", LinkPath: "cId", With: []string{"db.C"}, EstimatedCount: 2},
+		{Collection: "B", Path: "dIds", LinkPath: "dIds", With: []string{"db.A", "db.D"}, Multikey: true, EstimatedCount: 2},
+		{Collection: "A", Path: "items.bId", LinkPath: "items.$.bId", With: []string{"db.B"}, Multikey: true, EstimatedCount: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Recommend() = %+v, want %+v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, "db", got); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if !strings.Contains(b.String(), `db.getCollection("A").createIndex({ "items.bId": 1 });`) {
+		t.Errorf("Write() = %s, want the createIndex of A", b.String())
+	}
+}
@@ -0,0 +1,378 @@
+package anonymize
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	mrand "math/rand"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/flowHater/mongo-inferer/pkg/seeder"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/yaml.v2"
+)
+
+const primaryKey = "_id"
+
+// All the ways a field can be pseudonymised
+const (
+	// KindEmail replaces a value by an address of example.com
+	KindEmail = "email"
+	// KindName replaces every word by a capitalised word of the same length
+	KindName = "name"
+	// KindText replaces every word by a word of the same length, spaces and punctuation are kept
+	KindText = "text"
+	// KindHash replaces a value by an hexadecimal digest
+	KindHash = "hash"
+	// KindNull replaces a value by null
+	KindNull = "null"
+	// KindID replaces a value as the _ids are, it keeps valid the references to _ids that aren't ObjectIds,
+	// which discovery doesn't find
+	KindID = "id"
+)
+
+// Config tells which fields to pseudonymise: Fields holds by collection the kind of each link path,
+// a $ going through the elements of an array. The references to _ids that aren't ObjectIds need the id kind
+type Config struct {
+	Fields map[string]map[string]string `yaml:"fields" json:"fields"`
+}
+
+// LoadConfig reads and validates a Config written in YAML or JSON
+func LoadConfig(r io.Reader) (*Config, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error during reading config: %w", err)
+	}
+
+	c := &Config{}
+	// JSON is valid YAML
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, fmt.Errorf("Error during parsing config: %w", err)
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Validate checks that every kind of c is known
+func (c *Config) Validate() error {
+	for coll, fs := range c.Fields {
+		for p, k := range fs {
+			switch k {
+			case KindEmail, KindName, KindText, KindHash, KindNull, KindID:
+			default:
+				return fmt.Errorf("Invalid config: unknown kind %q of %s.%s", k, coll, p)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Scanner streams every document of a collection, an export can't do with samples
+type Scanner interface {
+	Each(ctx context.Context, db, collection string, fn func(m primitive.M) error) error
+}
+
+// Anonymizer rewrites documents so none of their _ids, ObjectIds and configured fields survive.
+// Every value is replaced by a keyed digest of it, so a value gets the same replacement in every collection
+// and references stay valid
+type Anonymizer struct {
+	key    []byte
+	fields map[string]map[string]string
+}
+
+// OptionF describes a func that will be called from the New func
+type OptionF func(*Anonymizer)
+
+// WithKey sets the secret keying the replacements, exports with the same key give the same replacements.
+// A random key is used by default
+func WithKey(key []byte) OptionF {
+	return func(a *Anonymizer) {
+		a.key = key
+	}
+}
+
+// New creates an Anonymizer of the fields of c
+func New(c *Config, opts ...OptionF) (*Anonymizer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	a := &Anonymizer{fields: c.Fields}
+
+	for _, o := range opts {
+		o(a)
+	}
+
+	if len(a.key) == 0 {
+		a.key = make([]byte, 32)
+		if _, err := rand.Read(a.key); err != nil {
+			return nil, fmt.Errorf("Error during generating a key: %w", err)
+		}
+	}
+
+	return a, nil
+}
+
+// ObjectID returns the replacement of id
+func (a *Anonymizer) ObjectID(id primitive.ObjectID) primitive.ObjectID {
+	var n primitive.ObjectID
+	copy(n[:], a.digest("objectId", string(id[:])))
+
+	return n
+}
+
+// ID returns the replacement of an _id, or of a reference to one. The type is kept and different IDs get
+// different replacements: ObjectIds and integers are permuted, strings and binaries (UUIDs) become digests.
+// The other values are hashed as with KindHash
+func (a *Anonymizer) ID(v interface{}) interface{} {
+	switch t := v.(type) {
+	case nil:
+		return nil
+	case primitive.ObjectID:
+		return a.ObjectID(t)
+	case string:
+		if id, err := primitive.ObjectIDFromHex(t); err == nil {
+			return a.ObjectID(id).Hex()
+		}
+		// Longer than an ObjectId in hexadecimal, so never taken for one
+		return "id-" + hex.EncodeToString(a.digest(KindID, t)[:16])
+	case int32:
+		return int32(a.permute(uint64(uint32(t)), 32))
+	case int64:
+		return int64(a.permute(uint64(t), 64))
+	case primitive.Binary:
+		sum := a.digest(KindID, string(append([]byte{t.Subtype}, t.Data...)))
+		if len(t.Data) < len(sum) {
+			sum = sum[:len(t.Data)]
+		}
+		return primitive.Binary{Subtype: t.Subtype, Data: sum}
+	case primitive.A:
+		arr := make(primitive.A, len(t))
+		for i, e := range t {
+			arr[i] = a.ID(e)
+		}
+		return arr
+	default:
+		return a.pseudonymise(v, KindHash)
+	}
+}
+
+// permute is a keyed permutation of the integers of bits bits: a Feistel network whose round functions are keyed
+// digests, so two integers never get the same replacement
+func (a *Anonymizer) permute(x uint64, bits uint) uint64 {
+	half := bits / 2
+	mask := uint64(1)<<half - 1
+	l, r := x>>half&mask, x&mask
+	for round := byte(0); round < 4; round++ {
+		var b [9]byte
+		b[0] = round
+		binary.BigEndian.PutUint64(b[1:], r)
+		f := binary.BigEndian.Uint64(a.digest("permute", string(b[:])))
+		l, r = r, (l^f)&mask
+	}
+
+	return l<<half | r
+}
+
+// Document returns the anonymised copy of m, a document of collection: every _id and ObjectId is replaced,
+// so is every string holding an ObjectId in hexadecimal, wherever it is, and the configured fields. Keys are sorted, _id first
+func (a *Anonymizer) Document(collection string, m primitive.M) primitive.D {
+	w := walker{a: a, fields: a.fields[collection]}
+	return w.document(m, "")
+}
+
+// walker rewrites the values of a document of a collection
+type walker struct {
+	a      *Anonymizer
+	fields map[string]string
+}
+
+func (w walker) document(m primitive.M, path string) primitive.D {
+	d := make(primitive.D, 0, len(m))
+	for _, k := range sortedKeys(m) {
+		p := k
+		if path != "" {
+			p = path + "." + k
+		}
+		d = append(d, primitive.E{Key: k, Value: w.value(m[k], p)})
+	}
+
+	return d
+}
+
+func (w walker) value(v interface{}, path string) interface{} {
+	if kind, ok := w.fields[path]; ok {
+		if kind == KindID {
+			return w.a.ID(v)
+		}
+		return w.a.pseudonymise(v, kind)
+	}
+	if path == primaryKey || strings.HasSuffix(path, "."+primaryKey) {
+		return w.a.ID(v)
+	}
+
+	switch t := v.(type) {
+	case primitive.ObjectID:
+		return w.a.ObjectID(t)
+	case string:
+		// A link the scan missed, or a string _id, must not keep the ID it holds
+		if id, err := primitive.ObjectIDFromHex(t); err == nil {
+			return w.a.ObjectID(id).Hex()
+		}
+		return t
+	case primitive.M:
+		return w.document(t, path)
+	case primitive.D:
+		return w.document(t.Map(), path)
+	case primitive.A:
+		a := make(primitive.A, len(t))
+		for i, e := range t {
+			a[i] = w.value(e, path+".$")
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// sortedKeys returns the keys of m sorted, _id first
+func sortedKeys(m primitive.M) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if (keys[i] == primaryKey) != (keys[j] == primaryKey) {
+			return keys[i] == primaryKey
+		}
+
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// pseudonymise replaces every string of v by its pseudonym of kind, ObjectIds are replaced as everywhere else.
+// The other values are hashed from their BSON encoding with KindHash and become null with the other kinds
+func (a *Anonymizer) pseudonymise(v interface{}, kind string) interface{} {
+	if kind == KindNull || v == nil {
+		return nil
+	}
+
+	switch t := v.(type) {
+	case primitive.ObjectID:
+		return a.ObjectID(t)
+	case string:
+		return a.pseudonym(t, kind)
+	case primitive.M:
+		d := make(primitive.D, 0, len(t))
+		for _, k := range sortedKeys(t) {
+			d = append(d, primitive.E{Key: k, Value: a.pseudonymise(t[k], kind)})
+		}
+		return d
+	case primitive.D:
+		return a.pseudonymise(t.Map(), kind)
+	case primitive.A:
+		arr := make(primitive.A, len(t))
+		for i, e := range t {
+			arr[i] = a.pseudonymise(e, kind)
+		}
+		return arr
+	default:
+		if kind != KindHash {
+			return nil
+		}
+
+		typ, data, err := bson.MarshalValue(t)
+		if err != nil {
+			return nil
+		}
+		sum := a.digest(kind, string(append([]byte{byte(typ)}, data...)))
+		return hex.EncodeToString(sum[:16])
+	}
+}
+
+func (a *Anonymizer) pseudonym(s, kind string) string {
+	sum := a.digest(kind, s)
+	switch kind {
+	case KindEmail:
+		return "user-" + hex.EncodeToString(sum[:16]) + "@example.com"
+	case KindName:
+		return words(s, sum, true)
+	case KindText:
+		return words(s, sum, false)
+	default:
+		return hex.EncodeToString(sum[:16])
+	}
+}
+
+// digest is the keyed digest of value, kind separates the replacements of the same value in different kinds
+func (a *Anonymizer) digest(kind, value string) []byte {
+	h := hmac.New(sha256.New, a.key)
+	h.Write([]byte(kind))
+	h.Write([]byte{0})
+	h.Write([]byte(value))
+
+	return h.Sum(nil)
+}
+
+// words replaces every letter and digit of s by one drawn from sum, capital tells to capitalise the words
+func words(s string, sum []byte, capital bool) string {
+	rnd := mrand.New(mrand.NewSource(int64(binary.BigEndian.Uint64(sum))))
+
+	b := strings.Builder{}
+	start := true
+	for _, r := range s {
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteByte(byte('0' + rnd.Intn(10)))
+		case unicode.IsLetter(r):
+			l := byte('a' + rnd.Intn(26))
+			if capital && start {
+				l -= 'a' - 'A'
+			}
+			b.WriteByte(l)
+		default:
+			b.WriteRune(r)
+			start = true
+			continue
+		}
+		start = false
+	}
+
+	return b.String()
+}
+
+// Export writes the anonymised documents of the collections of db into sink and closes it
+func Export(ctx context.Context, s Scanner, db string, collections []string, a *Anonymizer, sink seeder.Sink) error {
+	var err error
+	for _, c := range collections {
+		err = s.Each(ctx, db, c, func(m primitive.M) error {
+			return sink.Write(c, a.Document(c, m))
+		})
+		if err != nil {
+			err = fmt.Errorf("Error during exporting %s.%s: %w", db, c, err)
+			break
+		}
+	}
+
+	if cerr := sink.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
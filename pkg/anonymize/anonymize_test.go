@@ -0,0 +1,228 @@
+package anonymize
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// inmemSink inserts the exported documents into an in-memory Fetcher, going through BSON as a real export does
+type inmemSink struct {
+	f  *inmem.Fetcher
+	db string
+}
+
+func (s inmemSink) Write(collection string, doc primitive.D) error {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	m := primitive.M{}
+	if err := bson.Unmarshal(b, &m); err != nil {
+		return err
+	}
+
+	s.f.Insert(s.db, collection, m)
+	return nil
+}
+
+func (s inmemSink) Close() error { return nil }
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	alice, bob := primitive.NewObjectID(), primitive.NewObjectID()
+	src := inmem.New(0).
+		Insert("shop", "users",
+			primitive.M{"_id": alice, "email": "alice@corp.com", "name": "Alice Martin", "age": int32(31)},
+			primitive.M{"_id": bob, "email": "bob@corp.com", "name": "Bob", "contacts": primitive.A{primitive.M{"email": "alice@corp.com"}}},
+		).
+		Insert("shop", "orders",
+			primitive.M{"_id": primitive.NewObjectID(), "userId": alice, "note": "Leave it at the door, thanks!"},
+			primitive.M{"_id": primitive.NewObjectID(), "userId": bob.Hex(), "note": nil, "card": primitive.M{"number": "4242", "exp": int32(12)}},
+		)
+
+	d, err := discover.New(ctx, src)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "shop")
+	if err != nil || len(links["orders"]) == 0 {
+		t.Fatalf("Discover.Database() = %v, %v", links, err)
+	}
+
+	c := &Config{Fields: map[string]map[string]string{
+		"users":  {"email": KindEmail, "name": KindName, "contacts.$.email": KindEmail},
+		"orders": {"note": KindText, "card": KindHash},
+	}}
+	a, err := New(c, WithKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	dst := inmem.New(0)
+	if err := Export(ctx, src, "shop", []string{"orders", "users"}, a, inmemSink{f: dst, db: "shop"}); err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	users, _ := dst.SampleCollection(ctx, "shop", "users", 10)
+	orders, _ := dst.SampleCollection(ctx, "shop", "orders", 10)
+	for _, d := range append(users, orders...) {
+		for _, id := range []primitive.ObjectID{alice, bob} {
+			if d["_id"] == id || d["userId"] == id || d["userId"] == id.Hex() {
+				t.Errorf("original ID %s survived in %v", id.Hex(), d)
+			}
+		}
+	}
+
+	byID := map[interface{}]primitive.M{}
+	for _, u := range users {
+		byID[u["_id"]] = u
+	}
+	newAlice := a.ObjectID(alice)
+	if u := byID[newAlice]; u == nil || u["email"] == "alice@corp.com" || !strings.HasSuffix(u["email"].(string), "@example.com") {
+		t.Fatalf("users = %v, want %s with a pseudonymised email", users, newAlice.Hex())
+	}
+	if n := byID[newAlice]["name"].(string); len(n) != len("Alice Martin") || n[5] != ' ' || n[0] < 'A' || n[0] > 'Z' {
+		t.Errorf("name = %q, want two capitalised words of 5 and 6 letters", n)
+	}
+	if byID[newAlice]["age"] != int32(31) {
+		t.Errorf("age = %v, want it untouched", byID[newAlice]["age"])
+	}
+	contact := byID[a.ObjectID(bob)]["contacts"].(primitive.A)[0].(primitive.M)["email"]
+	if contact != byID[newAlice]["email"] {
+		t.Errorf("contact email = %v, want the pseudonym of alice %v", contact, byID[newAlice]["email"])
+	}
+
+	for _, o := range orders {
+		switch o["userId"] {
+		case newAlice:
+			if n := o["note"].(string); n == "Leave it at the door, thanks!" || len(n) != 29 || !strings.HasSuffix(n, "!") {
+				t.Errorf("note = %q, want a pseudonym of the same shape", n)
+			}
+		case a.ObjectID(bob).Hex():
+			card := o["card"].(primitive.M)
+			exp, _ := card["exp"].(string)
+			if o["note"] != nil || card["number"] == "4242" || len(exp) != 32 || exp == card["number"] {
+				t.Errorf("order = %v, want a null note and a hashed card", o)
+			}
+		default:
+			t.Errorf("userId = %v, want a remapped reference", o["userId"])
+		}
+	}
+
+	// Every reference must still resolve to the same collections
+	d, err = discover.New(ctx, dst)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err := d.Database(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, links) {
+		t.Errorf("links of the export = %v, want %v", got, links)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	c, err := LoadConfig(strings.NewReader("fields:\n  users: {email: email, bio: text}\n"))
+	if err != nil || c.Fields["users"]["bio"] != KindText {
+		t.Errorf("LoadConfig() = %v, %v", c, err)
+	}
+
+	if _, err := LoadConfig(strings.NewReader("fields:\n  users: {email: mask}\n")); err == nil || !strings.Contains(err.Error(), "unknown kind") {
+		t.Errorf("LoadConfig() error = %v, want an unknown kind", err)
+	}
+}
+
+func TestAnonymizer_Document(t *testing.T) {
+	id, other := primitive.NewObjectID(), primitive.NewObjectID()
+	a, err := New(&Config{Fields: map[string]map[string]string{"logs": {"email": KindEmail, "age": KindHash, "pin": KindHash}}}, WithKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	got := a.Document("logs", primitive.M{
+		"_id":     id.Hex(),
+		"payload": primitive.M{"target": other.Hex()},
+		"email":   "alice@corp.com",
+		"age":     int32(31),
+		"pin":     "31",
+		"note":    "not an id",
+	}).Map()
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{name: "string _id", got: got["_id"], want: a.ObjectID(id).Hex()},
+		{name: "hexadecimal string out of the links", got: got["payload"].(primitive.D).Map()["target"], want: a.ObjectID(other).Hex()},
+		{name: "other string", got: got["note"], want: "not an id"},
+		{name: "email", got: len(got["email"].(string)), want: len("user-@example.com") + 32},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	// A number is hashed, and not like the string of its digits
+	if age, _ := got["age"].(string); len(age) != 32 || age == got["pin"] {
+		t.Errorf("age = %v, want a digest different from the one of %q: %v", got["age"], "31", got["pin"])
+	}
+}
+
+func TestAnonymizer_ID(t *testing.T) {
+	a, err := New(&Config{Fields: map[string]map[string]string{"orders": {"userId": KindID}}}, WithKey([]byte("secret")))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	uuid := primitive.Binary{Subtype: 4, Data: []byte("0123456789abcdef")}
+	tests := []struct {
+		name string
+		id   interface{}
+	}{
+		{name: "int32", id: int32(7)},
+		{name: "int64", id: int64(7)},
+		{name: "string", id: "alice"},
+		{name: "UUID", id: uuid},
+		{name: "ObjectId", id: primitive.NewObjectID()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := a.Document("users", primitive.M{"_id": tt.id}).Map()["_id"]
+			if reflect.DeepEqual(user, tt.id) || reflect.TypeOf(user) != reflect.TypeOf(tt.id) {
+				t.Errorf("_id = %#v, want a replacement of the same type as %#v", user, tt.id)
+			}
+
+			// A reference configured as an id gets the replacement of the _id
+			ref := a.Document("orders", primitive.M{"userId": tt.id}).Map()["userId"]
+			if !reflect.DeepEqual(ref, user) {
+				t.Errorf("userId = %#v, want the replaced _id %#v", ref, user)
+			}
+		})
+	}
+
+	if b := a.ID(uuid).(primitive.Binary); b.Subtype != 4 || len(b.Data) != 16 {
+		t.Errorf("ID(uuid) = %v, want a UUID", b)
+	}
+
+	// Integers are permuted, none of them collide
+	seen := map[interface{}]bool{}
+	for i := int32(0); i < 10000; i++ {
+		id := a.ID(i)
+		if seen[id] {
+			t.Fatalf("ID(%d) = %v, already the replacement of a smaller integer", i, id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,150 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+const primitivePkg = "go.mongodb.org/mongo-driver/bson/primitive"
+
+// goStruct is a struct type waiting to be written
+type goStruct struct {
+	name string
+	doc  *schema.Document
+	path string
+	// comment is written above the type
+	comment string
+}
+
+type goGenerator struct {
+	m       Model
+	types   uniqueNames
+	queue   []goStruct
+	imports map[string]bool
+	body    bytes.Buffer
+}
+
+// Go writes a Go file of package pkg declaring a struct per collection of m, with nested structs for sub documents
+func Go(w io.Writer, pkg string, m Model) error {
+	g := &goGenerator{m: m, types: uniqueNames{}, imports: map[string]bool{}}
+
+	for _, c := range m.Collections() {
+		g.queue = append(g.queue, goStruct{
+			name:    g.types.get(exportedName(c)),
+			doc:     m.Schema(c),
+			comment: fmt.Sprintf("is a document of %s.%s, inferred from %d samples", m.DB, c, m.Schema(c).Count),
+		})
+
+		for len(g.queue) > 0 {
+			s := g.queue[0]
+			g.queue = g.queue[1:]
+			g.writeStruct(c, s)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by mongo-inferer. DO NOT EDIT.\n\npackage %s\n\n", pkg)
+	if len(g.imports) > 0 {
+		out.WriteString("import (\n")
+		if g.imports["time"] {
+			out.WriteString("\"time\"\n\n")
+		}
+		if g.imports[primitivePkg] {
+			fmt.Fprintf(&out, "%q\n", primitivePkg)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.body.Bytes())
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("Error during formatting generated Go code: %w", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+func (g *goGenerator) writeStruct(collection string, s goStruct) {
+	fmt.Fprintf(&g.body, "// %s %s\ntype %s struct {\n", s.name, s.comment, s.name)
+
+	fields := uniqueNames{}
+	for _, n := range s.doc.Names() {
+		f := s.doc.Fields[n]
+		path := childPath(s.path, n)
+		name := fields.get(exportedName(n))
+
+		tag := n
+		if s.doc.Optional(n) {
+			tag += ",omitempty"
+		}
+
+		if l, ok := g.m.Link(collection, path); ok {
+			fmt.Fprintf(&g.body, "// %s %s\n", name, describeLink(l))
+		} else if l, ok := g.m.Link(collection, itemsPath(path)); ok {
+			fmt.Fprintf(&g.body, "// %s %s\n", name, describeLink(l))
+		}
+
+		fmt.Fprintf(&g.body, "%s %s `bson:%q`\n", name, g.goType(f, s.name+name, path), tag)
+	}
+
+	g.body.WriteString("}\n\n")
+}
+
+// goType returns the Go type of f, nested structs are named typeName and queued
+func (g *goGenerator) goType(f *schema.Field, typeName, path string) string {
+	var t string
+	switch f.Dominant() {
+	case schema.TypeObjectID:
+		t = g.primitive("ObjectID")
+	case schema.TypeString:
+		t = "string"
+	case schema.TypeInt:
+		t = "int32"
+	case schema.TypeLong:
+		t = "int64"
+	case schema.TypeDouble:
+		t = "float64"
+	case schema.TypeDecimal:
+		t = g.primitive("Decimal128")
+	case schema.TypeBool:
+		t = "bool"
+	case schema.TypeDate:
+		g.imports["time"] = true
+		t = "time.Time"
+	case schema.TypeTimestamp:
+		t = g.primitive("Timestamp")
+	case schema.TypeBinary:
+		t = g.primitive("Binary")
+	case schema.TypeObject:
+		if len(f.Doc.Fields) == 0 {
+			return g.primitive("M")
+		}
+
+		t = g.types.get(typeName)
+		g.queue = append(g.queue, goStruct{name: t, doc: f.Doc, path: path, comment: fmt.Sprintf("is the sub document at %s", path)})
+	case schema.TypeArray:
+		if f.Items == nil || f.Items.Count == 0 {
+			return g.primitive("A")
+		}
+
+		return "[]" + g.goType(f.Items, typeName, itemsPath(path))
+	default:
+		return "interface{}"
+	}
+
+	if f.Nullable() {
+		return "*" + t
+	}
+
+	return t
+}
+
+func (g *goGenerator) primitive(t string) string {
+	g.imports[primitivePkg] = true
+	return "primitive." + t
+}
@@ -0,0 +1,50 @@
+package codegen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGo(t *testing.T) {
+	m := Model{
+		DB: "shop",
+		Schemas: map[string]*schema.Document{
+			"orders": schema.Infer([]primitive.M{
+				{"_id": primitive.NewObjectID(), "user_id": primitive.NewObjectID(), "at": primitive.NewDateTimeFromTime(time.Now()), "lines": primitive.A{primitive.M{"qty": int32(1)}}, "note": "x"},
+				{"_id": primitive.NewObjectID(), "user_id": primitive.NewObjectID(), "at": primitive.NewDateTimeFromTime(time.Now()), "lines": primitive.A{}, "note": nil},
+			}),
+		},
+		Links: map[string]discover.CollectionLinks{
+			"orders": {"user_id": {Path: "user_id", With: []string{"shop.users"}, Avg: 1}},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Go(buf, "models", m); err != nil {
+		t.Fatalf("Go() error = %v", err)
+	}
+
+	// gofmt alignment is not what is tested here
+	got := strings.Join(strings.Fields(buf.String()), " ")
+	for _, want := range []string{
+		"package models",
+		"type Orders struct {",
+		"ID primitive.ObjectID `bson:\"_id\"`",
+		"At time.Time `bson:\"at\"`",
+		"Lines []OrdersLines `bson:\"lines\"`",
+		"Note *string `bson:\"note\"`",
+		"// UserID references shop.users (in 100% of documents)",
+		"type OrdersLines struct {",
+		"Qty int32 `bson:\"qty\"`",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Go() output misses %q:\n%s", want, buf.String())
+		}
+	}
+}
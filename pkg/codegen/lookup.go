@@ -0,0 +1,267 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// lookupPrefix names the temporary fields holding the looked up documents until they are put in place
+const lookupPrefix = "_lookup"
+
+type lookupGenerator struct {
+	m Model
+}
+
+// Lookup returns an aggregation pipeline on collection replacing every link by the document it references,
+// and the links of those documents until depth.
+// Links to another database can't be looked up and are left as they are
+func Lookup(m Model, collection string, depth int) (primitive.A, error) {
+	if _, ok := m.Links[collection]; !ok {
+		return nil, fmt.Errorf("Unknown collection %s.%s", m.DB, collection)
+	}
+	if depth < 1 {
+		return nil, fmt.Errorf("Lookup depth must be at least 1, got %d", depth)
+	}
+
+	g := lookupGenerator{m: m}
+	return g.pipeline(collection, depth), nil
+}
+
+// LookupJSON writes the pipeline of Lookup as relaxed Extended JSON, ready for the mongo shell or Compass
+func LookupJSON(w io.Writer, m Model, collection string, depth int) error {
+	p, err := Lookup(m, collection, depth)
+	if err != nil {
+		return err
+	}
+
+	// MarshalExtJSON only takes documents, so the array is wrapped and unwrapped
+	raw, err := bson.MarshalExtJSON(primitive.D{{Key: "pipeline", Value: p}}, false, false)
+	if err != nil {
+		return fmt.Errorf("Error during encoding pipeline: %w", err)
+	}
+
+	var wrapped struct {
+		Pipeline json.RawMessage `json:"pipeline"`
+	}
+	if err := json.Unmarshal(raw, &wrapped); err != nil {
+		return fmt.Errorf("Error during encoding pipeline: %w", err)
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, wrapped.Pipeline, "", "  "); err != nil {
+		return fmt.Errorf("Error during encoding pipeline: %w", err)
+	}
+	b.WriteString("\n")
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// LookupGo writes a Go file of package pkg declaring the pipeline of Lookup as a primitive.A
+func LookupGo(w io.Writer, pkg string, m Model, collection string, depth int) error {
+	p, err := Lookup(m, collection, depth)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by mongo-inferer. DO NOT EDIT.\n\npackage %s\n\nimport %q\n\n", pkg, primitivePkg)
+	name := exportedName(collection) + "LookupPipeline"
+	fmt.Fprintf(&b, "// %s populates the links of %s.%s down to a depth of %d\nvar %s = ", name, m.DB, collection, depth, name)
+	writeGoValue(&b, p)
+	b.WriteString("\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		return fmt.Errorf("Error during formatting generated Go code: %w", err)
+	}
+
+	_, err = w.Write(src)
+	return err
+}
+
+func (g lookupGenerator) pipeline(collection string, depth int) primitive.A {
+	links := g.m.Links[collection]
+	paths := make([]string, 0, len(links))
+	for p := range links {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	stages := primitive.A{}
+	tmp := 0
+	for _, p := range paths {
+		l := links[p]
+		targets := []string{}
+		for _, w := range l.With {
+			if strings.TrimSuffix(w, "."+targetCollection(w)) == g.m.DB {
+				targets = append(targets, targetCollection(w))
+			}
+		}
+		if len(targets) == 0 {
+			continue
+		}
+
+		segments := strings.Split(l.Path, ".")
+		arrays := 0
+		for _, s := range segments {
+			if s == "$" {
+				arrays++
+			}
+		}
+		dot := discover.DotPath(l.Path)
+
+		// The documents are looked up aside and every ID is swapped with its document where it stands,
+		// so the order, the duplicates and the dangling IDs of the link are kept
+		found := primitive.A{}
+		foundIDs := primitive.A{}
+		unset := primitive.D{}
+		for _, t := range targets {
+			as := fmt.Sprintf("%s%d", lookupPrefix, tmp)
+			tmp++
+			stages = append(stages, g.lookup(t, dot, arrays, as, depth))
+			found = append(found, "$"+as)
+			foundIDs = append(foundIDs, "$"+as+"._id")
+			unset = append(unset, primitive.E{Key: as, Value: int32(0)})
+		}
+
+		var docs, ids interface{} = found[0], foundIDs[0]
+		if len(found) > 1 {
+			docs = primitive.D{{Key: "$concatArrays", Value: found}}
+			ids = primitive.D{{Key: "$concatArrays", Value: foundIDs}}
+		}
+
+		prefix := segments
+		for i, s := range segments {
+			if s == "$" {
+				prefix = segments[:i]
+				break
+			}
+		}
+		field := strings.Join(prefix, ".")
+		stages = append(stages,
+			primitive.D{{Key: "$addFields", Value: primitive.D{{Key: field, Value: replaceIDs("$"+field, segments[len(prefix):], docs, ids, 0)}}}},
+			primitive.D{{Key: "$project", Value: unset}},
+		)
+	}
+
+	return stages
+}
+
+// lookup returns the $lookup stage of the documents of target referenced at the dotted path dot, under arrays arrays.
+// The plain localField form is used when it's enough, a sub pipeline when nested arrays must be flattened
+// or when the looked up documents have links to populate too
+func (g lookupGenerator) lookup(target, dot string, arrays int, as string, depth int) primitive.D {
+	if arrays <= 1 && depth <= 1 {
+		return primitive.D{{Key: "$lookup", Value: primitive.D{
+			{Key: "from", Value: target},
+			{Key: "localField", Value: dot},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: as},
+		}}}
+	}
+
+	var let primitive.D
+	var match interface{}
+	if arrays == 0 {
+		let = primitive.D{{Key: "id", Value: "$" + dot}}
+		match = primitive.D{{Key: "$eq", Value: primitive.A{"$_id", "$$id"}}}
+	} else {
+		let = primitive.D{{Key: "ids", Value: primitive.D{{Key: "$ifNull", Value: primitive.A{flatten("$"+dot, arrays-1), primitive.A{}}}}}}
+		match = primitive.D{{Key: "$in", Value: primitive.A{"$_id", "$$ids"}}}
+	}
+
+	pipeline := primitive.A{primitive.D{{Key: "$match", Value: primitive.D{{Key: "$expr", Value: match}}}}}
+	if depth > 1 {
+		if _, ok := g.m.Links[target]; ok {
+			pipeline = append(pipeline, g.pipeline(target, depth-1)...)
+		}
+	}
+
+	return primitive.D{{Key: "$lookup", Value: primitive.D{
+		{Key: "from", Value: target},
+		{Key: "let", Value: let},
+		{Key: "pipeline", Value: pipeline},
+		{Key: "as", Value: as},
+	}}}
+}
+
+// flatten returns an expression concatenating n levels of nested arrays of expr
+func flatten(expr interface{}, n int) interface{} {
+	for i := 0; i < n; i++ {
+		expr = primitive.D{{Key: "$reduce", Value: primitive.D{
+			{Key: "input", Value: expr},
+			{Key: "initialValue", Value: primitive.A{}},
+			{Key: "in", Value: primitive.D{{Key: "$concatArrays", Value: primitive.A{"$$value", "$$this"}}}},
+		}}}
+	}
+
+	return expr
+}
+
+// replaceIDs returns an expression rebuilding value, the rest of the link path being segments,
+// with the ID at its end swapped with its document in docs, ids being the IDs of docs in the same order.
+// The ID is kept when it matches none
+func replaceIDs(value string, segments []string, docs, ids interface{}, level int) interface{} {
+	if len(segments) == 0 {
+		// $arrayElemAt reads -1 as the last document, so a missing ID must be caught before
+		return primitive.D{{Key: "$let", Value: primitive.D{
+			{Key: "vars", Value: primitive.D{{Key: "i", Value: primitive.D{{Key: "$indexOfArray", Value: primitive.A{ids, value}}}}}},
+			{Key: "in", Value: primitive.D{{Key: "$cond", Value: primitive.A{
+				primitive.D{{Key: "$eq", Value: primitive.A{"$$i", int32(-1)}}},
+				value,
+				primitive.D{{Key: "$arrayElemAt", Value: primitive.A{docs, "$$i"}}},
+			}}}},
+		}}}
+	}
+
+	if segments[0] == "$" {
+		e := fmt.Sprintf("e%d", level)
+		return primitive.D{{Key: "$map", Value: primitive.D{
+			{Key: "input", Value: value},
+			{Key: "as", Value: e},
+			{Key: "in", Value: replaceIDs("$$"+e, segments[1:], docs, ids, level+1)},
+		}}}
+	}
+
+	return primitive.D{{Key: "$mergeObjects", Value: primitive.A{
+		value,
+		primitive.D{{Key: segments[0], Value: replaceIDs(value+"."+segments[0], segments[1:], docs, ids, level)}},
+	}}}
+}
+
+// writeGoValue writes v as a Go literal, it only knows the types Lookup builds
+func writeGoValue(b *bytes.Buffer, v interface{}) {
+	switch t := v.(type) {
+	case primitive.A:
+		b.WriteString("primitive.A{\n")
+		for _, e := range t {
+			writeGoValue(b, e)
+			b.WriteString(",\n")
+		}
+		b.WriteString("}")
+	case primitive.D:
+		b.WriteString("primitive.D{\n")
+		for _, e := range t {
+			fmt.Fprintf(b, "{Key: %q, Value: ", e.Key)
+			writeGoValue(b, e.Value)
+			b.WriteString("},\n")
+		}
+		b.WriteString("}")
+	case string:
+		fmt.Fprintf(b, "%q", t)
+	case int32:
+		fmt.Fprintf(b, "int32(%d)", t)
+	default:
+		fmt.Fprintf(b, "%#v", t)
+	}
+}
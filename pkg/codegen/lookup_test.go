@@ -0,0 +1,160 @@
+package codegen
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestLookup(t *testing.T) {
+	m := Model{
+		DB: "shop",
+		Links: map[string]discover.CollectionLinks{
+			"orders": {
+				"userId":          {Path: "userId", With: []string{"shop.users"}},
+				"tagIds.$":        {Path: "tagIds.$", With: []string{"shop.tags"}},
+				"lines.$.itemId":  {Path: "lines.$.itemId", With: []string{"shop.items"}},
+				"boxes.$.$.tagId": {Path: "boxes.$.$.tagId", With: []string{"shop.tags"}},
+				"vendorId":        {Path: "vendorId", With: []string{"erp.vendors"}},
+			},
+			"users": {"groupId": {Path: "groupId", With: []string{"shop.groups"}}},
+		},
+	}
+
+	got, err := Lookup(m, "orders", 1)
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	for _, st := range got {
+		if _, ok := st.(primitive.D).Map()["$unwind"]; ok {
+			t.Errorf("Lookup() has an $unwind stage %v, a dangling reference would lose its field", st)
+		}
+	}
+
+	users := lookups(got, "users")
+	if len(users) != 1 || users[0]["localField"] != "userId" {
+		t.Fatalf("Lookup() users stages = %v, want one on userId", users)
+	}
+	as := "$" + users[0]["as"].(string)
+	want := primitive.D{{Key: "$let", Value: primitive.D{
+		{Key: "vars", Value: primitive.D{{Key: "i", Value: primitive.D{{Key: "$indexOfArray", Value: primitive.A{as + "._id", "$userId"}}}}}},
+		{Key: "in", Value: primitive.D{{Key: "$cond", Value: primitive.A{
+			primitive.D{{Key: "$eq", Value: primitive.A{"$$i", int32(-1)}}},
+			"$userId",
+			primitive.D{{Key: "$arrayElemAt", Value: primitive.A{as, "$$i"}}},
+		}}}},
+	}}}
+	if userID, _ := addedField(got, "userId"); !reflect.DeepEqual(userID, want) {
+		t.Errorf("Lookup() userId = %v, want %v keeping a dangling ID", userID, want)
+	}
+
+	tags := lookups(got, "tags")
+	if len(tags) != 2 {
+		t.Fatalf("Lookup() tags stages = %v, want one for tagIds and one for boxes", tags)
+	}
+	for _, field := range []string{"tagIds", "lines", "boxes"} {
+		expr, _ := addedField(got, field)
+		d, _ := expr.(primitive.D)
+		if _, ok := d.Map()["$map"]; !ok {
+			t.Errorf("Lookup() %s = %v, want a $map keeping the order and duplicates of the array", field, expr)
+		}
+	}
+
+	items := lookups(got, "items")
+	if len(items) != 1 || items[0]["localField"] != "lines.itemId" {
+		t.Errorf("Lookup() items stages = %v, want one on lines.itemId", items)
+	}
+
+	nested := tags[0]
+	if nested["localField"] == "tagIds" {
+		nested = tags[1]
+	}
+	if _, ok := nested["pipeline"]; !ok {
+		t.Errorf("Lookup() boxes stage = %v, want a sub pipeline flattening the nested arrays", nested)
+	}
+
+	if vendors := lookups(got, "vendors"); len(vendors) != 0 {
+		t.Errorf("Lookup() vendors stages = %v, want none for another database", vendors)
+	}
+	removed := unset(got)
+	for _, from := range []string{"users", "tags", "items"} {
+		for _, l := range lookups(got, from) {
+			if !removed[l["as"].(string)] {
+				t.Errorf("Lookup() leaves the temporary field %s", l["as"])
+			}
+		}
+	}
+
+	deep, err := Lookup(m, "orders", 2)
+	if err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+	var b bytes.Buffer
+	if err := LookupJSON(&b, Model{DB: m.DB, Links: m.Links}, "orders", 2); err != nil {
+		t.Fatalf("LookupJSON() error = %v", err)
+	}
+	var stages []interface{}
+	if err := json.Unmarshal(b.Bytes(), &stages); err != nil || len(stages) != len(deep) {
+		t.Errorf("LookupJSON() = %s, want %d stages (%v)", b.String(), len(deep), err)
+	}
+	if !strings.Contains(b.String(), `"from": "groups"`) {
+		t.Errorf("LookupJSON() misses the lookup of the groups of users:\n%s", b.String())
+	}
+
+	b.Reset()
+	if err := LookupGo(&b, "queries", m, "orders", 1); err != nil {
+		t.Fatalf("LookupGo() error = %v", err)
+	}
+	if !strings.Contains(b.String(), "var OrdersLookupPipeline = primitive.A{") {
+		t.Errorf("LookupGo() = %s, want the OrdersLookupPipeline var", b.String())
+	}
+
+	if _, err := Lookup(m, "unknown", 1); err == nil {
+		t.Errorf("Lookup() of an unknown collection error = nil")
+	}
+}
+
+// lookups returns the $lookup stages of pipeline reading from the collection from
+func lookups(pipeline primitive.A, from string) []primitive.M {
+	found := []primitive.M{}
+	for _, st := range pipeline {
+		if l, ok := st.(primitive.D).Map()["$lookup"]; ok && l.(primitive.D).Map()["from"] == from {
+			found = append(found, l.(primitive.D).Map())
+		}
+	}
+
+	return found
+}
+
+// addedField returns the expression of the $addFields stage of pipeline setting field
+func addedField(pipeline primitive.A, field string) (interface{}, bool) {
+	for _, st := range pipeline {
+		if a, ok := st.(primitive.D).Map()["$addFields"]; ok {
+			if expr, ok := a.(primitive.D).Map()[field]; ok {
+				return expr, true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// unset returns the fields removed by the $project stages of pipeline
+func unset(pipeline primitive.A) map[string]bool {
+	removed := map[string]bool{}
+	for _, st := range pipeline {
+		if p, ok := st.(primitive.D).Map()["$project"]; ok {
+			for _, e := range p.(primitive.D) {
+				removed[e.Key] = true
+			}
+		}
+	}
+
+	return removed
+}
@@ -0,0 +1,177 @@
+package codegen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+// Model is what the generators work from: the inferred schemas and the discovered links of a database.
+// Its JSON form is the saved inference result
+type Model struct {
+	DB      string                              `json:"db"`
+	Schemas map[string]*schema.Document         `json:"schemas"`
+	Links   map[string]discover.CollectionLinks `json:"links"`
+}
+
+// Collections returns the names of all collections of m sorted
+func (m Model) Collections() []string {
+	set := map[string]struct{}{}
+	for c := range m.Schemas {
+		set[c] = struct{}{}
+	}
+	for c := range m.Links {
+		set[c] = struct{}{}
+	}
+
+	cls := make([]string, 0, len(set))
+	for c := range set {
+		cls = append(cls, c)
+	}
+	sort.Strings(cls)
+
+	return cls
+}
+
+// Schema returns the schema of collection, an empty Document if it was not sampled
+func (m Model) Schema(collection string) *schema.Document {
+	if d, ok := m.Schemas[collection]; ok {
+		return d
+	}
+
+	return schema.NewDocument()
+}
+
+// Link returns the link found at path in collection
+func (m Model) Link(collection, path string) (discover.Link, bool) {
+	l, ok := m.Links[collection][path]
+	return l, ok
+}
+
+// describeLink is the human readable form of l used in comments
+func describeLink(l discover.Link) string {
+	return fmt.Sprintf("references %s (in %.0f%% of documents)", strings.Join(l.With, " or "), l.Avg*100)
+}
+
+// childPath returns the link path of name inside the document at path
+func childPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
+
+// itemsPath returns the link path of the elements of the array at path
+func itemsPath(path string) string {
+	return path + ".$"
+}
+
+// exportedName turns a collection or field name into an exported identifier, e.g. user_accounts -> UserAccounts
+func exportedName(s string) string {
+	if s == "_id" {
+		return "ID"
+	}
+
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	var b strings.Builder
+	for _, p := range parts {
+		rs := []rune(p)
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+
+	n := b.String()
+	switch {
+	case n == "":
+		return "Field"
+	case unicode.IsDigit([]rune(n)[0]):
+		n = "F" + n
+	}
+
+	switch {
+	case strings.HasSuffix(n, "Id"):
+		n = strings.TrimSuffix(n, "Id") + "ID"
+	case strings.HasSuffix(n, "Ids"):
+		n = strings.TrimSuffix(n, "Ids") + "IDs"
+	}
+
+	return n
+}
+
+// uniqueNames keeps identifiers unique by suffixing the ones already taken
+type uniqueNames map[string]int
+
+func (u uniqueNames) get(n string) string {
+	u[n]++
+	if u[n] == 1 {
+		return n
+	}
+
+	return fmt.Sprintf("%s%d", n, u[n])
+}
+
+// targetCollection returns the collection of a db.collection link target
+func targetCollection(with string) string {
+	if i := strings.Index(with, "."); i >= 0 {
+		return with[i+1:]
+	}
+
+	return with
+}
+
+// discriminator returns a string field of doc whose values all are, exactly, the model name of one of the targets
+// of a polymorphic link, "" when there is none. A Mongoose refPath needs the exact model names
+func discriminator(doc *schema.Document, l discover.Link, modelName func(collection string) string) string {
+	if len(l.With) < 2 {
+		return ""
+	}
+
+	targets := map[string]struct{}{}
+	for _, w := range l.With {
+		targets[modelName(targetCollection(w))] = struct{}{}
+	}
+
+	for _, n := range doc.Names() {
+		f := doc.Fields[n]
+		if f.Dominant() != schema.TypeString || f.Truncated || len(f.Values) < 2 {
+			continue
+		}
+
+		all := true
+		for v := range f.Values {
+			if _, ok := targets[v]; !ok {
+				all = false
+				break
+			}
+		}
+
+		if all {
+			return n
+		}
+	}
+
+	return ""
+}
+
+// jsKey quotes name when it is not a valid JavaScript identifier
+func jsKey(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return fmt.Sprintf("'%s'", strings.ReplaceAll(name, "'", "\\'"))
+		}
+	}
+
+	if name == "" {
+		return "''"
+	}
+
+	return name
+}
@@ -0,0 +1,165 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+type mongooseGenerator struct {
+	m          Model
+	collection string
+	// models are the model names by collection
+	models map[string]string
+}
+
+// Mongoose writes a module exporting a Mongoose Schema and model per collection of m.
+// Links become ObjectId paths with a ref, or a refPath when a polymorphic link has a discriminator field
+func Mongoose(w io.Writer, m Model) error {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by mongo-inferer. DO NOT EDIT.\n\nimport { Schema, model } from 'mongoose';\n\n")
+
+	names := uniqueNames{}
+	models := map[string]string{}
+	for _, c := range m.Collections() {
+		models[c] = names.get(exportedName(c))
+	}
+
+	for _, c := range m.Collections() {
+		g := mongooseGenerator{m: m, collection: c, models: models}
+		name := models[c]
+		doc := m.Schema(c)
+
+		fmt.Fprintf(&b, "// %s.%s, inferred from %d samples\n", m.DB, c, doc.Count)
+		fmt.Fprintf(&b, "export const %sSchema = new Schema(%s, { collection: '%s' });\n\n", name, g.document(doc, "", ""), c)
+		fmt.Fprintf(&b, "export const %s = model('%s', %sSchema);\n\n", name, name, name)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// document returns the object literal declaring all paths of doc
+func (g mongooseGenerator) document(doc *schema.Document, path, indent string) string {
+	var b strings.Builder
+	b.WriteString("{\n")
+
+	for _, n := range doc.Names() {
+		f := doc.Fields[n]
+		// Mongoose adds an ObjectId _id to every schema by itself
+		if n == "_id" && f.Dominant() == schema.TypeObjectID && path == "" {
+			continue
+		}
+
+		p := childPath(path, n)
+		required := !doc.Optional(n) && !f.Nullable()
+		def, comment := g.field(f, doc, p, required, indent+"  ")
+		// In a nested object a type key would declare the type of the object itself
+		if n == "type" && path != "" && !strings.HasPrefix(def, "{ type: ") {
+			def = fmt.Sprintf("{ type: %s }", def)
+		}
+		if comment != "" {
+			fmt.Fprintf(&b, "%s  // %s\n", indent, comment)
+		}
+		fmt.Fprintf(&b, "%s  %s: %s,\n", indent, jsKey(n), def)
+	}
+
+	b.WriteString(indent + "}")
+	return b.String()
+}
+
+// field returns the definition of f at path and a comment about its link, parent is the document holding f
+func (g mongooseGenerator) field(f *schema.Field, parent *schema.Document, path string, required bool, indent string) (string, string) {
+	switch f.Dominant() {
+	case schema.TypeObject:
+		if len(f.Doc.Fields) > 0 {
+			return g.document(f.Doc, path, indent), ""
+		}
+	case schema.TypeArray:
+		if f.Items == nil || f.Items.Count == 0 {
+			return "[]", ""
+		}
+
+		def, comment := g.field(f.Items, parent, itemsPath(path), false, indent)
+		return "[" + def + "]", comment
+	}
+
+	opts := []string{}
+	comment := ""
+	if l, ok := g.m.Link(g.collection, path); ok {
+		comment = describeLink(l)
+		switch d := discriminator(parent, l, g.modelName); {
+		case len(l.With) == 1:
+			opts = append(opts, fmt.Sprintf("ref: '%s'", g.modelName(targetCollection(l.With[0]))))
+		case d != "":
+			opts = append(opts, fmt.Sprintf("refPath: '%s'", discover.DotPath(childPath(parentPath(path), d))))
+		default:
+			comment += ", no field holding the model names " + strings.Join(g.modelNames(l), ", ") + " for a refPath"
+		}
+	}
+
+	if required {
+		opts = append(opts, "required: true")
+	}
+
+	t := mongooseType(f)
+	if len(opts) == 0 {
+		return t, comment
+	}
+
+	return fmt.Sprintf("{ type: %s, %s }", t, strings.Join(opts, ", ")), comment
+}
+
+// modelName returns the name of the model of collection, the generated one when it's part of the model
+func (g mongooseGenerator) modelName(collection string) string {
+	if n, ok := g.models[collection]; ok {
+		return n
+	}
+
+	return exportedName(collection)
+}
+
+// modelNames returns the model names of the targets of l
+func (g mongooseGenerator) modelNames(l discover.Link) []string {
+	ns := make([]string, 0, len(l.With))
+	for _, w := range l.With {
+		ns = append(ns, g.modelName(targetCollection(w)))
+	}
+
+	return ns
+}
+
+func mongooseType(f *schema.Field) string {
+	switch f.Dominant() {
+	case schema.TypeObjectID:
+		return "Schema.Types.ObjectId"
+	case schema.TypeString:
+		return "String"
+	case schema.TypeInt, schema.TypeLong, schema.TypeDouble:
+		return "Number"
+	case schema.TypeDecimal:
+		return "Schema.Types.Decimal128"
+	case schema.TypeBool:
+		return "Boolean"
+	case schema.TypeDate:
+		return "Date"
+	case schema.TypeBinary:
+		return "Buffer"
+	default:
+		return "Schema.Types.Mixed"
+	}
+}
+
+// parentPath returns the path of the document holding path, array markers included
+func parentPath(path string) string {
+	path = strings.TrimSuffix(path, ".$")
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		return path[:i]
+	}
+
+	return ""
+}
@@ -0,0 +1,62 @@
+package codegen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMongoose(t *testing.T) {
+	m := Model{
+		DB: "app",
+		Schemas: map[string]*schema.Document{
+			"comments": schema.Infer([]primitive.M{
+				{"_id": primitive.NewObjectID(), "authorId": primitive.NewObjectID(), "kind": "Posts", "target": primitive.NewObjectID(), "likes": primitive.A{primitive.M{"by": primitive.NewObjectID()}},
+					"meta": primitive.M{"type": "text", "size": int32(1)}},
+				{"_id": primitive.NewObjectID(), "authorId": primitive.NewObjectID(), "kind": "Videos", "target": primitive.NewObjectID(), "likes": primitive.A{},
+					"meta": primitive.M{"size": int32(2)}},
+			}),
+			// The values are collection names, not model names
+			"notes": schema.Infer([]primitive.M{
+				{"_id": primitive.NewObjectID(), "parentKind": "posts", "parent": primitive.NewObjectID()},
+				{"_id": primitive.NewObjectID(), "parentKind": "videos", "parent": primitive.NewObjectID()},
+			}),
+		},
+		Links: map[string]discover.CollectionLinks{
+			"comments": {
+				"authorId":   {Path: "authorId", With: []string{"app.users"}, Avg: 1},
+				"target":     {Path: "target", With: []string{"app.posts", "app.videos"}, Avg: 1},
+				"likes.$.by": {Path: "likes.$.by", With: []string{"app.users"}, Avg: 0.5},
+			},
+			"notes": {
+				"parent": {Path: "parent", With: []string{"app.posts", "app.videos"}, Avg: 1},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Mongoose(buf, m); err != nil {
+		t.Fatalf("Mongoose() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"export const CommentsSchema = new Schema({",
+		"authorId: { type: Schema.Types.ObjectId, ref: 'Users', required: true },",
+		"target: { type: Schema.Types.ObjectId, refPath: 'kind', required: true },",
+		"// references app.posts or app.videos (in 100% of documents), no field holding the model names Posts, Videos for a refPath",
+		"parent: { type: Schema.Types.ObjectId, required: true },",
+		"type: { type: String },",
+		"likes: [{",
+		"by: { type: Schema.Types.ObjectId, ref: 'Users', required: true },",
+		"}, { collection: 'comments' });",
+		"export const Comments = model('Comments', CommentsSchema);",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Mongoose() output misses %q:\n%s", want, buf.String())
+		}
+	}
+}
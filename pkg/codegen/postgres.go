@@ -0,0 +1,313 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+const (
+	pgObjectID = "char(24)"
+	pgKey      = "id"
+)
+
+type pgColumn struct {
+	name    string
+	typ     string
+	notNull bool
+	path    string
+}
+
+type pgTable struct {
+	name       string
+	collection string
+	// parent is the table holding the array this table was made of, "" for collections
+	parent  string
+	keyType string
+	columns []pgColumn
+	names   uniqueNames
+}
+
+type pgGenerator struct {
+	m      Model
+	tables []*pgTable
+	names  uniqueNames
+	// roots are the tables of the collections by collection name, targets of the foreign keys
+	roots  map[string]*pgTable
+	report []string
+}
+
+// Postgres writes a PostgreSQL DDL proposal for m: a table per collection with flattened sub documents,
+// a child table per array and a foreign key per link.
+// Everything that could not be represented is listed in a report written as comments at the end
+func Postgres(w io.Writer, m Model) error {
+	g := &pgGenerator{m: m, names: uniqueNames{}, roots: map[string]*pgTable{}}
+
+	for _, c := range m.Collections() {
+		doc := m.Schema(c)
+		t := g.newTable(snakeName(c), c, "")
+		t.keyType = "text"
+		if id, ok := doc.Fields["_id"]; ok {
+			t.keyType = g.scalarType(c, id, "_id")
+		} else {
+			g.reportf("%s: no _id sampled, the key is declared as text", c)
+		}
+		t.columns = append(t.columns, pgColumn{name: t.names.get(pgKey), typ: t.keyType, notNull: true, path: "_id"})
+
+		g.roots[c] = t
+		g.flatten(t, doc, "", "")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "-- Generated by mongo-inferer from %s.\n\n", m.DB)
+	for _, t := range g.tables {
+		g.writeTable(&b, t)
+	}
+	g.writeForeignKeys(&b)
+
+	if len(g.report) > 0 {
+		b.WriteString("-- Mapping report, what could not be represented:\n")
+		for _, r := range g.report {
+			fmt.Fprintf(&b, "--   %s\n", r)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (g *pgGenerator) reportf(format string, args ...interface{}) {
+	g.report = append(g.report, fmt.Sprintf(format, args...))
+}
+
+func (g *pgGenerator) newTable(name, collection, parent string) *pgTable {
+	t := &pgTable{name: g.names.get(name), collection: collection, parent: parent, names: uniqueNames{}}
+	g.tables = append(g.tables, t)
+
+	return t
+}
+
+// flatten adds the fields of doc to t, sub documents become prefixed columns and arrays child tables
+func (g *pgGenerator) flatten(t *pgTable, doc *schema.Document, path, prefix string) {
+	for _, n := range doc.Names() {
+		f := doc.Fields[n]
+		p := childPath(path, n)
+		if p == "_id" {
+			continue
+		}
+
+		notNull := !doc.Optional(n) && !f.Nullable()
+		g.addField(t, f, p, prefix+snakeName(n), notNull)
+	}
+}
+
+func (g *pgGenerator) addField(t *pgTable, f *schema.Field, path, column string, notNull bool) {
+	switch f.Dominant() {
+	case schema.TypeObject:
+		if len(f.Doc.Fields) > 0 {
+			if notNull {
+				g.flatten(t, f.Doc, path, column+"_")
+			} else {
+				// Columns of an optional sub document can't be NOT NULL
+				g.flattenOptional(t, f.Doc, path, column+"_")
+			}
+			return
+		}
+	case schema.TypeArray:
+		g.childTable(t, f, path, column)
+		return
+	}
+
+	t.columns = append(t.columns, pgColumn{name: t.names.get(column), typ: g.scalarType(t.collection, f, path), notNull: notNull, path: path})
+}
+
+func (g *pgGenerator) flattenOptional(t *pgTable, doc *schema.Document, path, prefix string) {
+	for _, n := range doc.Names() {
+		g.addField(t, doc.Fields[n], childPath(path, n), prefix+snakeName(n), false)
+	}
+}
+
+// childTable declares the table holding the elements of the array f
+func (g *pgGenerator) childTable(parent *pgTable, f *schema.Field, path, column string) {
+	child := g.newTable(parent.name+"_"+column, parent.collection, parent.name)
+	child.keyType = "bigint"
+	child.columns = append(child.columns,
+		pgColumn{name: child.names.get(pgKey), typ: "bigserial", notNull: true},
+		pgColumn{name: child.names.get("parent_id"), typ: parent.keyType, notNull: true},
+		pgColumn{name: child.names.get("position"), typ: "integer", notNull: true},
+	)
+
+	items := f.Items
+	if items == nil || items.Count == 0 {
+		g.reportf("%s.%s: only empty arrays were sampled, %s has no value column", parent.collection, path, child.name)
+		return
+	}
+
+	if items.Dominant() == schema.TypeObject && len(items.Doc.Fields) > 0 {
+		g.flatten(child, items.Doc, itemsPath(path), "")
+		return
+	}
+
+	g.addField(child, items, itemsPath(path), "value", !items.Nullable())
+}
+
+// scalarType maps a field to a column type, what can't be mapped is stored as jsonb and reported
+func (g *pgGenerator) scalarType(collection string, f *schema.Field, path string) string {
+	if _, ok := g.m.Link(collection, path); ok && onlyIDs(f) {
+		return pgObjectID
+	}
+
+	switch f.Dominant() {
+	case schema.TypeObjectID:
+		return pgObjectID
+	case schema.TypeString:
+		return "text"
+	case schema.TypeInt:
+		return "integer"
+	case schema.TypeLong:
+		return "bigint"
+	case schema.TypeDouble:
+		return "double precision"
+	case schema.TypeDecimal:
+		return "numeric"
+	case schema.TypeBool:
+		return "boolean"
+	case schema.TypeDate:
+		return "timestamptz"
+	case schema.TypeBinary:
+		return "bytea"
+	case schema.TypeTimestamp:
+		g.reportf("%s.%s: BSON timestamps are stored as bigint", collection, path)
+		return "bigint"
+	case schema.TypeNull:
+		g.reportf("%s.%s: only null values were sampled, stored as jsonb", collection, path)
+	case schema.TypeObject:
+		g.reportf("%s.%s: only empty sub documents were sampled, stored as jsonb", collection, path)
+	default:
+		g.reportf("%s.%s: mixed types %s, stored as jsonb", collection, path, typeList(f))
+	}
+
+	return "jsonb"
+}
+
+func (g *pgGenerator) writeTable(b *bytes.Buffer, t *pgTable) {
+	fmt.Fprintf(b, "CREATE TABLE %s (\n", pgIdent(t.name))
+
+	for _, c := range t.columns {
+		fmt.Fprintf(b, "  %s %s", pgIdent(c.name), c.typ)
+		if c.notNull {
+			b.WriteString(" NOT NULL")
+		}
+		b.WriteString(",\n")
+	}
+
+	fmt.Fprintf(b, "  PRIMARY KEY (%s)", pgIdent(pgKey))
+	if t.parent != "" {
+		fmt.Fprintf(b, ",\n  UNIQUE (%s, %s),\n  FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE CASCADE",
+			pgIdent("parent_id"), pgIdent("position"), pgIdent("parent_id"), pgIdent(t.parent), pgIdent(pgKey))
+	}
+	b.WriteString("\n);\n\n")
+}
+
+// writeForeignKeys turns links into constraints once all tables exist, so their order does not matter
+func (g *pgGenerator) writeForeignKeys(b *bytes.Buffer) {
+	for _, t := range g.tables {
+		for _, c := range t.columns {
+			if c.path == "" || c.path == "_id" {
+				continue
+			}
+
+			l, ok := g.m.Link(t.collection, c.path)
+			if !ok {
+				continue
+			}
+
+			target, ok := g.linkTarget(t.collection, c, l)
+			if !ok {
+				continue
+			}
+
+			fmt.Fprintf(b, "ALTER TABLE %s ADD FOREIGN KEY (%s) REFERENCES %s (%s);\n",
+				pgIdent(t.name), pgIdent(c.name), pgIdent(target.name), pgIdent(pgKey))
+		}
+	}
+	b.WriteString("\n")
+}
+
+func (g *pgGenerator) linkTarget(collection string, c pgColumn, l discover.Link) (*pgTable, bool) {
+	if len(l.With) > 1 {
+		g.reportf("%s.%s: polymorphic link to %s, no foreign key", collection, c.path, strings.Join(l.With, ", "))
+		return nil, false
+	}
+
+	db := strings.TrimSuffix(l.With[0], "."+targetCollection(l.With[0]))
+	target, ok := g.roots[targetCollection(l.With[0])]
+	if db != g.m.DB || !ok {
+		g.reportf("%s.%s: link to %s outside of %s, no foreign key", collection, c.path, l.With[0], g.m.DB)
+		return nil, false
+	}
+
+	if target.keyType != c.typ {
+		g.reportf("%s.%s: link to %s whose key is %s, not %s, no foreign key", collection, c.path, l.With[0], target.keyType, c.typ)
+		return nil, false
+	}
+
+	return target, true
+}
+
+// onlyIDs reports whether f holds ObjectIds, as such or as hexadecimal strings
+func onlyIDs(f *schema.Field) bool {
+	for t := range f.Types {
+		if t != schema.TypeObjectID && t != schema.TypeString && t != schema.TypeNull {
+			return false
+		}
+	}
+
+	return true
+}
+
+func typeList(f *schema.Field) string {
+	ts := []string{}
+	for t := range f.Types {
+		ts = append(ts, string(t))
+	}
+	sort.Strings(ts)
+
+	return strings.Join(ts, "/")
+}
+
+// snakeName turns a name into a lower snake case identifier, e.g. createdAt -> created_at
+func snakeName(s string) string {
+	var b strings.Builder
+	rs := []rune(s)
+	for i, r := range rs {
+		switch {
+		case unicode.IsUpper(r):
+			if i > 0 && (unicode.IsLower(rs[i-1]) || unicode.IsDigit(rs[i-1])) {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+
+	n := strings.Trim(b.String(), "_")
+	if n == "" {
+		return "field"
+	}
+
+	return n
+}
+
+func pgIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,49 @@
+package codegen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPostgres(t *testing.T) {
+	m := Model{
+		DB: "shop",
+		Schemas: map[string]*schema.Document{
+			"users": schema.Infer([]primitive.M{{"_id": primitive.NewObjectID(), "name": "a"}}),
+			"orders": schema.Infer([]primitive.M{
+				{"_id": primitive.NewObjectID(), "userId": primitive.NewObjectID(), "shipping": primitive.M{"city": "x"}, "itemIds": primitive.A{primitive.NewObjectID()}, "meta": "x"},
+				{"_id": primitive.NewObjectID(), "userId": primitive.NewObjectID().Hex(), "itemIds": primitive.A{}, "meta": int32(1)},
+			}),
+		},
+		Links: map[string]discover.CollectionLinks{
+			"orders": {
+				"userId":    {Path: "userId", With: []string{"shop.users"}, Avg: 1},
+				"itemIds.$": {Path: "itemIds.$", With: []string{"catalog.items"}, Avg: 0.5},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := Postgres(buf, m); err != nil {
+		t.Fatalf("Postgres() error = %v", err)
+	}
+
+	got := strings.Join(strings.Fields(buf.String()), " ")
+	for _, want := range []string{
+		`CREATE TABLE "orders" ( "id" char(24) NOT NULL, "meta" jsonb NOT NULL, "shipping_city" text, "user_id" char(24) NOT NULL, PRIMARY KEY ("id") );`,
+		`CREATE TABLE "orders_item_ids" ( "id" bigserial NOT NULL, "parent_id" char(24) NOT NULL, "position" integer NOT NULL, "value" char(24) NOT NULL,`,
+		`FOREIGN KEY ("parent_id") REFERENCES "orders" ("id") ON DELETE CASCADE`,
+		`ALTER TABLE "orders" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id");`,
+		`-- orders.meta: mixed types int/string, stored as jsonb`,
+		`-- orders.itemIds.$: link to catalog.items outside of shop, no foreign key`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Postgres() output misses %q:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+type tsInterface struct {
+	name string
+	doc  *schema.Document
+	path string
+}
+
+type tsGenerator struct {
+	m     Model
+	types uniqueNames
+	queue []tsInterface
+	body  bytes.Buffer
+}
+
+// TypeScript writes a TypeScript module exporting an interface per collection of m
+func TypeScript(w io.Writer, m Model) error {
+	g := &tsGenerator{m: m, types: uniqueNames{}}
+
+	for _, c := range m.Collections() {
+		name := g.types.get(exportedName(c))
+		fmt.Fprintf(&g.body, "/** A document of %s.%s, inferred from %d samples */\n", m.DB, c, m.Schema(c).Count)
+		g.queue = append(g.queue, tsInterface{name: name, doc: m.Schema(c)})
+
+		for len(g.queue) > 0 {
+			i := g.queue[0]
+			g.queue = g.queue[1:]
+			g.writeInterface(c, i)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "// Code generated by mongo-inferer. DO NOT EDIT.\n\nimport { Types } from 'mongoose';\n\n%s", g.body.String())
+	return err
+}
+
+func (g *tsGenerator) writeInterface(collection string, i tsInterface) {
+	fmt.Fprintf(&g.body, "export interface %s {\n", i.name)
+
+	for _, n := range i.doc.Names() {
+		f := i.doc.Fields[n]
+		path := childPath(i.path, n)
+
+		if l, ok := g.m.Link(collection, path); ok {
+			fmt.Fprintf(&g.body, "  /** %s */\n", describeLink(l))
+		} else if l, ok := g.m.Link(collection, itemsPath(path)); ok {
+			fmt.Fprintf(&g.body, "  /** %s */\n", describeLink(l))
+		}
+
+		optional := ""
+		if i.doc.Optional(n) {
+			optional = "?"
+		}
+
+		fmt.Fprintf(&g.body, "  %s%s: %s;\n", jsKey(n), optional, g.tsType(f, i.name+exportedName(n), path))
+	}
+
+	g.body.WriteString("}\n\n")
+}
+
+// tsType returns the TypeScript type of f, nested interfaces are named typeName and queued
+func (g *tsGenerator) tsType(f *schema.Field, typeName, path string) string {
+	var t string
+	switch f.Dominant() {
+	case schema.TypeObjectID:
+		t = "Types.ObjectId"
+	case schema.TypeString:
+		t = "string"
+	case schema.TypeInt, schema.TypeLong, schema.TypeDouble:
+		t = "number"
+	case schema.TypeDecimal:
+		t = "Types.Decimal128"
+	case schema.TypeBool:
+		t = "boolean"
+	case schema.TypeDate:
+		t = "Date"
+	case schema.TypeBinary:
+		t = "Buffer"
+	case schema.TypeNull:
+		return "null"
+	case schema.TypeObject:
+		if len(f.Doc.Fields) == 0 {
+			t = "Record<string, unknown>"
+			break
+		}
+
+		t = g.types.get(typeName)
+		g.queue = append(g.queue, tsInterface{name: t, doc: f.Doc, path: path})
+	case schema.TypeArray:
+		if f.Items == nil || f.Items.Count == 0 {
+			t = "unknown[]"
+			break
+		}
+
+		items := g.tsType(f.Items, typeName, itemsPath(path))
+		if strings.Contains(items, " ") {
+			items = "(" + items + ")"
+		}
+		t = items + "[]"
+	default:
+		t = "unknown"
+	}
+
+	if f.Nullable() {
+		return t + " | null"
+	}
+
+	return t
+}
@@ -0,0 +1,53 @@
+package codegen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestTypeScript(t *testing.T) {
+	m := Model{
+		DB: "app",
+		Schemas: map[string]*schema.Document{
+			"orders": schema.Infer([]primitive.M{
+				{"_id": primitive.NewObjectID(), "userId": primitive.NewObjectID(), "productIds": primitive.A{primitive.NewObjectID()}, "note": "n",
+					"address": primitive.M{"city": "Paris", "zip": int32(75001)}, "first-name": "Alice", "paidAt": nil},
+				{"_id": primitive.NewObjectID(), "userId": primitive.NewObjectID(), "productIds": primitive.A{},
+					"address": primitive.M{"city": "Lyon"}, "first-name": "Bob", "paidAt": "2020-01-01"},
+			}),
+		},
+		Links: map[string]discover.CollectionLinks{
+			"orders": {
+				"userId":       {Path: "userId", With: []string{"app.users"}, Avg: 1},
+				"productIds.$": {Path: "productIds.$", With: []string{"app.products"}, Avg: 0.5},
+			},
+		},
+	}
+
+	buf := &bytes.Buffer{}
+	if err := TypeScript(buf, m); err != nil {
+		t.Fatalf("TypeScript() error = %v", err)
+	}
+
+	for _, want := range []string{
+		"import { Types } from 'mongoose';",
+		"/** A document of app.orders, inferred from 2 samples */\nexport interface Orders {",
+		"  _id: Types.ObjectId;",
+		"  /** references app.users (in 100% of documents) */\n  userId: Types.ObjectId;",
+		"  /** references app.products (in 50% of documents) */\n  productIds: Types.ObjectId[];",
+		"  note?: string;",
+		"  paidAt: string | null;",
+		"  'first-name': string;",
+		"  address: OrdersAddress;",
+		"export interface OrdersAddress {\n  city: string;\n  zip?: number;\n}",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("TypeScript() output misses %q:\n%s", want, buf.String())
+		}
+	}
+}
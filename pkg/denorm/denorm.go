@@ -0,0 +1,374 @@
+package denorm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sourceField is the temporary field of a sync pipeline holding the referenced document
+const sourceField = "_source"
+
+// Source samples the referencing collections and fetches the documents they reference, to compare the copies with their originals
+type Source interface {
+	SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error)
+	FindByIDs(ctx context.Context, db, collection string, ids []primitive.ObjectID) ([]primitive.M, error)
+}
+
+// Copy is a field of a sub-document holding a reference which copies the field of the same name of the referenced document
+type Copy struct {
+	Collection string `json:"collection"`
+	// Path is the link path of the copy, LinkPath the one of the reference next to it
+	Path     string `json:"path"`
+	LinkPath string `json:"linkPath"`
+	// With is the db.collection of the referenced documents and Field their copied field
+	With  string `json:"with"`
+	Field string `json:"field"`
+	// Compared is the number of sampled copies whose referenced document was found, Stale the ones that differ from it
+	Compared int `json:"compared"`
+	Stale    int `json:"stale"`
+}
+
+// StaleRatio returns the ratio of the compared copies that differ from the referenced document
+func (c Copy) StaleRatio() float64 {
+	if c.Compared == 0 {
+		return 0
+	}
+
+	return float64(c.Stale) / float64(c.Compared)
+}
+
+// pair is a sampled sub-document and the ID it references
+type pair struct {
+	sub primitive.M
+	id  primitive.ObjectID
+}
+
+// stats counts the comparisons of a field with a referenced collection
+type stats struct {
+	compared int
+	stale    int
+}
+
+// Detect samples size documents of every collection of links in db and compares the siblings of every reference
+// held by a sub-document with the referenced document.
+// A sibling is a copy when it's equal to the field of the same name at least once, so the copies that are always stale
+// in the sample can't be told apart from an unrelated field. The stalest copies come first
+func Detect(ctx context.Context, s Source, db string, links map[string]discover.CollectionLinks, size int) ([]Copy, error) {
+	cs := []Copy{}
+
+	collections := make([]string, 0, len(links))
+	for c := range links {
+		collections = append(collections, c)
+	}
+	sort.Strings(collections)
+
+	for _, c := range collections {
+		var samples []primitive.M
+		for _, p := range sortedLinks(links[c]) {
+			l := links[c][p]
+			i := strings.LastIndex(l.Path, ".")
+			if i < 0 || l.Path[i+1:] == "$" {
+				continue
+			}
+			parent, key := l.Path[:i], l.Path[i+1:]
+
+			if samples == nil {
+				var err error
+				samples, err = s.SampleCollection(ctx, db, c, size)
+				if err != nil {
+					return nil, fmt.Errorf("Error during sampling %s.%s: %w", db, c, err)
+				}
+			}
+
+			found, err := compare(ctx, s, pairs(samples, parent, key), key, l.With)
+			if err != nil {
+				return nil, err
+			}
+
+			for with, fields := range found {
+				for f, st := range fields {
+					if st.stale == st.compared {
+						continue
+					}
+
+					cs = append(cs, Copy{
+						Collection: c,
+						Path:       parent + "." + f,
+						LinkPath:   l.Path,
+						With:       with,
+						Field:      f,
+						Compared:   st.compared,
+						Stale:      st.stale,
+					})
+				}
+			}
+		}
+	}
+
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].StaleRatio() != cs[j].StaleRatio() {
+			return cs[i].StaleRatio() > cs[j].StaleRatio()
+		}
+		if cs[i].Collection != cs[j].Collection {
+			return cs[i].Collection < cs[j].Collection
+		}
+		if cs[i].Path != cs[j].Path {
+			return cs[i].Path < cs[j].Path
+		}
+
+		return cs[i].With < cs[j].With
+	})
+
+	return cs, nil
+}
+
+// pairs returns the sub-documents of samples at the link path parent holding a reference at key
+func pairs(samples []primitive.M, parent, key string) []pair {
+	ps := []pair{}
+	for _, m := range samples {
+		for _, v := range discover.ValuesAt(m, parent) {
+			sub, ok := document(v)
+			if !ok {
+				continue
+			}
+			if id, ok := discover.ObjectIDOf(sub[key]); ok {
+				ps = append(ps, pair{sub: sub, id: id})
+			}
+		}
+	}
+
+	return ps
+}
+
+// compare looks ps up in the collections of with and compares the siblings of key, the counts are by db.collection then field
+func compare(ctx context.Context, s Source, ps []pair, key string, with []string) (map[string]map[string]*stats, error) {
+	found := map[string]map[string]*stats{}
+	resolved := map[primitive.ObjectID]bool{}
+
+	for _, w := range with {
+		i := strings.Index(w, ".")
+		if i < 0 {
+			continue
+		}
+
+		ids := []primitive.ObjectID{}
+		for _, p := range ps {
+			if !resolved[p.id] {
+				ids = append(ids, p.id)
+			}
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		docs, err := s.FindByIDs(ctx, w[:i], w[i+1:], ids)
+		if err != nil {
+			return nil, fmt.Errorf("Error during finding documents of %s: %w", w, err)
+		}
+
+		byID := map[primitive.ObjectID]primitive.M{}
+		for _, d := range docs {
+			if id, ok := d["_id"].(primitive.ObjectID); ok {
+				byID[id] = d
+			}
+		}
+
+		for _, p := range ps {
+			src, ok := byID[p.id]
+			if !ok {
+				continue
+			}
+			resolved[p.id] = true
+
+			for f, v := range p.sub {
+				sv, ok := src[f]
+				if f == key || !ok {
+					continue
+				}
+
+				if found[w] == nil {
+					found[w] = map[string]*stats{}
+				}
+				st := found[w][f]
+				if st == nil {
+					st = &stats{}
+					found[w][f] = st
+				}
+
+				st.compared++
+				if !equal(v, sv) {
+					st.stale++
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// document returns v as a primitive.M when it's a document
+func document(v interface{}) (primitive.M, bool) {
+	switch t := v.(type) {
+	case primitive.M:
+		return t, true
+	case primitive.D:
+		return t.Map(), true
+	default:
+		return nil, false
+	}
+}
+
+// equal compares two values ignoring the order of keys and the type of numbers
+func equal(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case int32:
+		return float64(t)
+	case int64:
+		return float64(t)
+	case primitive.D:
+		return normalize(t.Map())
+	case primitive.M:
+		m := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			m[k] = normalize(e)
+		}
+		return m
+	case primitive.A:
+		a := make([]interface{}, len(t))
+		for i, e := range t {
+			a[i] = normalize(e)
+		}
+		return a
+	default:
+		return v
+	}
+}
+
+// Sync is the refresh of the copies held next to a reference from the referenced documents
+type Sync struct {
+	Collection string
+	LinkPath   string
+	// With is the db.collection of the referenced documents
+	With   string
+	Copies []Copy
+}
+
+// Syncs groups cs by reference, in the order of their first copy
+func Syncs(cs []Copy) []Sync {
+	ss := []Sync{}
+	index := map[string]int{}
+	for _, c := range cs {
+		k := c.Collection + "|" + c.LinkPath + "|" + c.With
+		i, ok := index[k]
+		if !ok {
+			i = len(ss)
+			index[k] = i
+			ss = append(ss, Sync{Collection: c.Collection, LinkPath: c.LinkPath, With: c.With})
+		}
+		ss[i].Copies = append(ss[i].Copies, c)
+	}
+
+	return ss
+}
+
+// Pipeline returns the aggregation pipeline of db rewriting the copies of s, nil when $lookup can't reach them:
+// the reference is in an array or the referenced collection is in another database.
+// The references must be ObjectIds since $lookup doesn't convert hexadecimal strings
+func (s Sync) Pipeline(db string) primitive.A {
+	if strings.Contains(s.LinkPath, "$") || !strings.HasPrefix(s.With, db+".") {
+		return nil
+	}
+
+	set := primitive.D{}
+	for _, c := range s.Copies {
+		set = append(set, primitive.E{Key: c.Path, Value: "$" + sourceField + "." + c.Field})
+	}
+
+	return primitive.A{
+		primitive.D{{Key: "$lookup", Value: primitive.D{
+			{Key: "from", Value: strings.TrimPrefix(s.With, db+".")},
+			{Key: "localField", Value: s.LinkPath},
+			{Key: "foreignField", Value: "_id"},
+			{Key: "as", Value: sourceField},
+		}}},
+		primitive.D{{Key: "$unwind", Value: "$" + sourceField}},
+		primitive.D{{Key: "$set", Value: set}},
+		primitive.D{{Key: "$unset", Value: sourceField}},
+		primitive.D{{Key: "$merge", Value: primitive.D{
+			{Key: "into", Value: s.Collection},
+			{Key: "on", Value: "_id"},
+			{Key: "whenMatched", Value: "replace"},
+			{Key: "whenNotMatched", Value: "discard"},
+		}}},
+	}
+}
+
+// Write prints cs and the mongo shell commands syncing them, nothing is executed
+func Write(w io.Writer, db string, cs []Copy) error {
+	var b strings.Builder
+	if len(cs) == 0 {
+		fmt.Fprintf(&b, "// No denormalised copy found in %s.\n", db)
+	} else {
+		fmt.Fprintf(&b, "// %d denormalised copies found in %s, the stalest first.\n", len(cs), db)
+	}
+
+	for _, c := range cs {
+		fmt.Fprintf(&b, "// %s.%s copies %s.%s: %d of %d stale (%.0f%%)\n", c.Collection, c.Path, c.With, c.Field, c.Stale, c.Compared, 100*c.StaleRatio())
+	}
+
+	if len(cs) > 0 {
+		d, _ := json.Marshal(db)
+		fmt.Fprintf(&b, "\ndb = db.getSiblingDB(%s);\n", d)
+	}
+
+	for _, s := range Syncs(cs) {
+		p := s.Pipeline(db)
+		if p == nil {
+			fmt.Fprintf(&b, "\n// %s.%s can't be synced from %s by a single pipeline\n", s.Collection, s.LinkPath, s.With)
+			continue
+		}
+
+		// MarshalExtJSON only takes documents, so the array is wrapped and unwrapped
+		raw, err := bson.MarshalExtJSON(primitive.D{{Key: "pipeline", Value: p}}, false, false)
+		if err != nil {
+			return fmt.Errorf("Error during encoding sync of %s.%s: %w", s.Collection, s.LinkPath, err)
+		}
+
+		var wrapped struct {
+			Pipeline json.RawMessage `json:"pipeline"`
+		}
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return fmt.Errorf("Error during encoding sync of %s.%s: %w", s.Collection, s.LinkPath, err)
+		}
+
+		c, _ := json.Marshal(s.Collection)
+		fmt.Fprintf(&b, "\n// Sync of %s.%s from %s\n", s.Collection, s.LinkPath, s.With)
+		fmt.Fprintf(&b, "db.getCollection(%s).aggregate(%s);\n", c, wrapped.Pipeline)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func sortedLinks(cl discover.CollectionLinks) []string {
+	ps := make([]string, 0, len(cl))
+	for p := range cl {
+		ps = append(ps, p)
+	}
+	sort.Strings(ps)
+
+	return ps
+}
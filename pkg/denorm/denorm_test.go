@@ -0,0 +1,70 @@
+package denorm
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDetect(t *testing.T) {
+	ctx := context.Background()
+	alice, bob, pen := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	f := inmem.New(0).
+		Insert("shop", "users",
+			primitive.M{"_id": alice, "name": "Alice", "email": "alice@example.com", "since": int32(2019)},
+			primitive.M{"_id": bob, "name": "Bob", "email": "bob@example.com", "since": int32(2020)},
+		).
+		Insert("shop", "products", primitive.M{"_id": pen, "title": "Pen", "price": 2.5}).
+		Insert("shop", "orders",
+			primitive.M{"_id": primitive.NewObjectID(), "customer": primitive.M{"_id": alice, "name": "Alice", "email": "alice@example.com", "since": int64(2019)},
+				"lines": primitive.A{primitive.M{"product": primitive.M{"_id": pen, "title": "Pen", "price": 2.0}}}},
+			primitive.M{"_id": primitive.NewObjectID(), "customer": primitive.M{"_id": bob, "name": "Robert", "email": "bob@example.com", "since": int32(1999)},
+				"lines": primitive.A{primitive.M{"product": primitive.M{"_id": pen.Hex(), "title": "Pen", "price": 2.0}}}},
+		)
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cs, err := Detect(ctx, f, "shop", links, 100)
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+
+	// price was always stale so it can't be told from an unrelated field
+	want := []Copy{
+		{Collection: "orders", Path: "customer.name", LinkPath: "customer._id", With: "shop.users", Field: "name", Compared: 2, Stale: 1},
+		{Collection: "orders", Path: "customer.since", LinkPath: "customer._id", With: "shop.users", Field: "since", Compared: 2, Stale: 1},
+		{Collection: "orders", Path: "customer.email", LinkPath: "customer._id", With: "shop.users", Field: "email", Compared: 2, Stale: 0},
+		{Collection: "orders", Path: "lines.$.product.title", LinkPath: "lines.$.product._id", With: "shop.products", Field: "title", Compared: 2, Stale: 0},
+	}
+	if !reflect.DeepEqual(cs, want) {
+		t.Fatalf("Detect() = %+v, want %+v", cs, want)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, "shop", cs); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for _, s := range []string{
+		"// orders.customer.name copies shop.users.name: 1 of 2 stale (50%)",
+		`{"$set":{"customer.name":"$_source.name","customer.since":"$_source.since","customer.email":"$_source.email"}}`,
+		`{"$merge":{"into":"orders","on":"_id","whenMatched":"replace","whenNotMatched":"discard"}}`,
+		"// orders.lines.$.product._id can't be synced from shop.products by a single pipeline",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Write() = %s, want %s", b.String(), s)
+		}
+	}
+}
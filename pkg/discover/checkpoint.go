@@ -0,0 +1,216 @@
+package discover
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+const checkpointVersion = 2
+
+// CheckpointKey identifies the scan a checkpoint belongs to, a checkpoint of another scan is never resumed
+type CheckpointKey struct {
+	// Source describes where the documents come from, e.g. the hosts of the cluster or the exported directory
+	Source   string
+	Database string
+}
+
+// Checkpoint persists the links of each scanned collection and the ID cache to a file
+// so an interrupted scan can be resumed.
+// The file is a header line followed by one line per finished collection, each save only appends
+type Checkpoint struct {
+	mu          sync.Mutex
+	f           *os.File
+	key         CheckpointKey
+	collections map[string]CollectionLinks
+	cache       map[string]bool
+}
+
+// checkpointHeader is the first line of a checkpoint, the scan it belongs to
+type checkpointHeader struct {
+	Version    int
+	Key        CheckpointKey
+	SampleSize int
+}
+
+// checkpointEntry is the line of a finished collection with the cache entries found since the previous line
+type checkpointEntry struct {
+	Collection string
+	Links      CollectionLinks
+	Cache      map[string]bool
+}
+
+// OpenCheckpoint creates a Checkpoint of the scan key writing to path.
+// With resume the content of an existing file is loaded, it must belong to the same scan.
+// Otherwise the file is started over
+func OpenCheckpoint(path string, key CheckpointKey, resume bool) (*Checkpoint, error) {
+	c := &Checkpoint{key: key, collections: map[string]CollectionLinks{}, cache: map[string]bool{}}
+
+	if resume {
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err == nil {
+			c.f = f
+			if err := c.load(); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("Error during resuming checkpoint %s: %w", path, err)
+			}
+
+			return c, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("Error during opening checkpoint %s: %w", path, err)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error during creating checkpoint %s: %w", path, err)
+	}
+	c.f = f
+	if err := c.append(checkpointHeader{Version: checkpointVersion, Key: key, SampleSize: sampleSize}); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// load reads the header and entries of the file of c, a truncated last line left by a crash is dropped
+func (c *Checkpoint) load() error {
+	r := bufio.NewReader(c.f)
+	valid := int64(0)
+	header := true
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Without its newline the last line was not completely written
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if header {
+			h := checkpointHeader{}
+			if err := json.Unmarshal(line, &h); err != nil {
+				return fmt.Errorf("invalid header: %w", err)
+			}
+			if h.Version != checkpointVersion {
+				return fmt.Errorf("version %d, expected %d", h.Version, checkpointVersion)
+			}
+			if h.Key != c.key || h.SampleSize != sampleSize {
+				return fmt.Errorf("it belongs to the scan of %s from %s with samples of %d, not of %s from %s with samples of %d",
+					h.Key.Database, h.Key.Source, h.SampleSize, c.key.Database, c.key.Source, sampleSize)
+			}
+			header = false
+		} else {
+			e := checkpointEntry{}
+			if err := json.Unmarshal(line, &e); err != nil {
+				return fmt.Errorf("invalid entry at offset %d: %w", valid, err)
+			}
+			c.collections[e.Collection] = e.Links
+			for k, v := range e.Cache {
+				c.cache[k] = v
+			}
+		}
+		valid += int64(len(line))
+	}
+
+	if header {
+		return fmt.Errorf("no header")
+	}
+
+	if err := c.f.Truncate(valid); err != nil {
+		return err
+	}
+	_, err := c.f.Seek(valid, io.SeekStart)
+	return err
+}
+
+// append writes v as a line and flushes it to the disk
+func (c *Checkpoint) append(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("Error during encoding checkpoint: %w", err)
+	}
+
+	if _, err := c.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("Error during writing checkpoint %s: %w", c.f.Name(), err)
+	}
+	if err := c.f.Sync(); err != nil {
+		return fmt.Errorf("Error during writing checkpoint %s: %w", c.f.Name(), err)
+	}
+
+	return nil
+}
+
+// Close closes the file of c
+func (c *Checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.f.Close()
+}
+
+// WithCheckpoint makes Database skip the collections already completed in c
+// and record every collection it finishes, the ID cache is restored from c
+func WithCheckpoint(c *Checkpoint) OptionF {
+	return func(d *Discover) {
+		d.checkpoint = c
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		d.cacheExists.Lock()
+		defer d.cacheExists.Unlock()
+		for k, v := range c.cache {
+			d.cacheExists.m[k] = v
+		}
+	}
+}
+
+// check returns an error when db is not the database c belongs to
+func (c *Checkpoint) check(db string) error {
+	if db != c.key.Database {
+		return fmt.Errorf("Checkpoint %s belongs to the scan of %s, not %s", c.f.Name(), c.key.Database, db)
+	}
+
+	return nil
+}
+
+// completed returns the links of collection if it was already scanned
+func (c *Checkpoint) completed(collection string) (CollectionLinks, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cls, ok := c.collections[collection]
+	return cls, ok
+}
+
+// save appends the links of collection and the entries of cache that are not in the file yet
+func (c *Checkpoint) save(collection string, cls CollectionLinks, cache cacheExists) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e := checkpointEntry{Collection: collection, Links: cls, Cache: map[string]bool{}}
+	cache.RLock()
+	for k, v := range cache.m {
+		if saved, ok := c.cache[k]; !ok || saved != v {
+			e.Cache[k] = v
+		}
+	}
+	cache.RUnlock()
+
+	if err := c.append(e); err != nil {
+		return err
+	}
+
+	c.collections[collection] = cls
+	for k, v := range e.Cache {
+		c.cache[k] = v
+	}
+
+	return nil
+}
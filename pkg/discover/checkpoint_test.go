@@ -0,0 +1,167 @@
+package discover_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingFetcher counts the ID probes sent to its Fetcher
+type countingFetcher struct {
+	*inmem.Fetcher
+	mu     sync.Mutex
+	probes int
+}
+
+func (f *countingFetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	f.mu.Lock()
+	f.probes++
+	f.mu.Unlock()
+
+	return f.Fetcher.ExistsByID(ctx, db, collection, id)
+}
+
+func TestCheckpoint_Resume(t *testing.T) {
+	ctx := context.Background()
+	a := primitive.NewObjectID()
+	newFetcher := func() *countingFetcher {
+		return &countingFetcher{Fetcher: inmem.New(0).
+			Insert("db", "A", primitive.M{"_id": a}).
+			Insert("db", "B", primitive.M{"_id": primitive.NewObjectID(), "aId": a})}
+	}
+	key := discover.CheckpointKey{Source: "inmem", Database: "db"}
+
+	// scan runs a scan of db with the checkpoint at path and returns its links,
+	// the number of probes and the collections whose samples reached the sample observer
+	scan := func(t *testing.T, path string, key discover.CheckpointKey, resume bool, db string) (map[string]discover.CollectionLinks, int, map[string]bool, error) {
+		c, err := discover.OpenCheckpoint(path, key, resume)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		defer c.Close()
+
+		o := &sampleRecorder{sampled: map[string]int{}}
+		f := newFetcher()
+		d, err := discover.New(ctx, f, discover.WithCheckpoint(c), discover.WithSampleObserver(o))
+		if err != nil {
+			t.Fatalf("New() error = %v", err)
+		}
+		links, err := d.Database(ctx, db)
+
+		sampled := map[string]bool{}
+		for c, n := range o.sampled {
+			sampled[c] = n > 0
+		}
+
+		return links, f.probes, sampled, err
+	}
+
+	tests := []struct {
+		name string
+		// prepare alters the checkpoint of a complete scan
+		prepare    func(t *testing.T, path string)
+		key        discover.CheckpointKey
+		resume     bool
+		db         string
+		wantProbes bool
+		// wantLines checks the number of lines of the file after the second scan instead of the probes
+		wantLines int
+		wantErr   bool
+	}{
+		{name: "complete checkpoint", key: key, resume: true, db: "db"},
+		{name: "without resume the file is started over", key: key, db: "db", wantProbes: true},
+		{name: "missing file", prepare: func(t *testing.T, path string) { os.Remove(path) }, key: key, resume: true, db: "db", wantProbes: true},
+		{name: "truncated last line is redone", prepare: func(t *testing.T, path string) { truncate(t, path, 10) }, key: key, resume: true, db: "db", wantLines: 3},
+		{name: "corrupt entry", prepare: func(t *testing.T, path string) { corrupt(t, path) }, key: key, resume: true, db: "db", wantErr: true},
+		{name: "other source", key: discover.CheckpointKey{Source: "other", Database: "db"}, resume: true, db: "db", wantErr: true},
+		{name: "other database", key: discover.CheckpointKey{Source: "inmem", Database: "db2"}, resume: true, db: "db", wantErr: true},
+		{name: "scan of another database", key: key, db: "db2", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "checkpoint")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "checkpoint")
+
+			want, probes, _, err := scan(t, path, key, false, "db")
+			if err != nil || probes == 0 {
+				t.Fatalf("first scan error = %v with %d probes", err, probes)
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, path)
+			}
+
+			got, probes, sampled, err := scan(t, path, tt.key, tt.resume, tt.db)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("second scan error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if tt.wantLines > 0 {
+				b, err := ioutil.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n := bytes.Count(b, []byte("\n")); n != tt.wantLines || !bytes.HasSuffix(b, []byte("\n")) {
+					t.Errorf("checkpoint has %d lines, want %d complete lines:\n%s", n, tt.wantLines, b)
+				}
+			} else if (probes > 0) != tt.wantProbes {
+				t.Errorf("second scan made %d probes, wantProbes %v", probes, tt.wantProbes)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("second scan = %v, want %v", got, want)
+			}
+			if !sampled["A"] || !sampled["B"] {
+				t.Errorf("samples of %v reached the sample observer, want A and B", sampled)
+			}
+		})
+	}
+}
+
+// truncate cuts the last n bytes of the file at path
+func truncate(t *testing.T, path string, n int64) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, fi.Size()-n); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// corrupt replaces the first entry of the file at path with garbage, keeping the following lines
+func corrupt(t *testing.T, path string) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []byte{}
+	n := 0
+	for _, c := range b {
+		if n == 1 && c != '\n' {
+			c = '#'
+		}
+		if c == '\n' {
+			n++
+		}
+		lines = append(lines, c)
+	}
+	if err := ioutil.WriteFile(path, lines, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,156 @@
+package discover_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// timingOutFetcher times out when sampling the collection B
+type timingOutFetcher struct {
+	*inmem.Fetcher
+}
+
+func (f timingOutFetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	if collection == "B" {
+		return nil, context.DeadlineExceeded
+	}
+
+	return f.Fetcher.SampleCollection(ctx, db, collection, size)
+}
+
+func TestDatabase_ScanErrorChain(t *testing.T) {
+	ctx := context.Background()
+	f := timingOutFetcher{inmem.New(0).
+		Insert("db", "A", primitive.M{"_id": primitive.NewObjectID()}).
+		Insert("db", "B", primitive.M{"_id": primitive.NewObjectID()})}
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "db")
+
+	var scanErr *discover.ScanError
+	if !errors.As(err, &scanErr) || len(scanErr.Failures) != 1 {
+		t.Fatalf("Database() error = %v, want a ScanError with one failure", err)
+	}
+	if !errors.Is(scanErr.Failures[0].Err, context.DeadlineExceeded) {
+		t.Errorf("Failures[0].Err = %v, want it to wrap context.DeadlineExceeded", scanErr.Failures[0].Err)
+	}
+	if _, ok := links["A"]; !ok {
+		t.Errorf("Database() = %v, want the links of A", links)
+	}
+}
+
+// skippingFetcher counts the ID probes sent to its Fetcher, except the ones of skip
+type skippingFetcher struct {
+	*inmem.Fetcher
+	skip   primitive.ObjectID
+	mu     sync.Mutex
+	probes int
+}
+
+func (f *skippingFetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	if id != f.skip {
+		f.mu.Lock()
+		f.probes++
+		f.mu.Unlock()
+	}
+
+	return f.Fetcher.ExistsByID(ctx, db, collection, id)
+}
+
+func TestDatabase_EmbeddedIDs(t *testing.T) {
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	f := &skippingFetcher{Fetcher: inmem.New(0).Insert("db", "users", primitive.M{"_id": user}), skip: user}
+	for i := 0; i < 20; i++ {
+		// Every item is an embedded entity with its own _id, the author is a copy of a user
+		f.Insert("db", "posts", primitive.M{
+			"_id":    primitive.NewObjectID(),
+			"item":   primitive.M{"_id": primitive.NewObjectID()},
+			"author": primitive.M{"_id": user},
+		})
+	}
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "db")
+	if err != nil {
+		t.Fatalf("Database() error = %v", err)
+	}
+
+	if l, ok := links["posts"]["author._id"]; !ok || l.Avg != 1 {
+		t.Errorf("Database() = %v, want the link author._id in every post", links)
+	}
+	if _, ok := links["posts"]["item._id"]; ok {
+		t.Errorf("Database() = %v, want no link item._id", links)
+	}
+	// item._id is only probed in both collections for the first 20% of the posts
+	if f.probes != 4*2 {
+		t.Errorf("Database() made %d probes of items, want %d", f.probes, 4*2)
+	}
+}
+
+// orderedFetcher samples the posts in the order they are listed
+type orderedFetcher struct {
+	*inmem.Fetcher
+	posts []primitive.M
+}
+
+func (f orderedFetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	if collection == "posts" {
+		return f.posts, nil
+	}
+
+	return f.Fetcher.SampleCollection(ctx, db, collection, size)
+}
+
+func TestDatabase_EmbeddedIDsMissingFirst(t *testing.T) {
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	f := orderedFetcher{Fetcher: inmem.New(0).Insert("db", "users", primitive.M{"_id": user})}
+	for i := 0; i < 40; i++ {
+		// The first authors were deleted, their copies dangle
+		author := user
+		if i < 6 {
+			author = primitive.NewObjectID()
+		}
+		f.posts = append(f.posts, primitive.M{"_id": primitive.NewObjectID(), "author": primitive.M{"_id": author}})
+	}
+	f.Insert("db", "posts", f.posts...)
+
+	tests := []struct {
+		name string
+		opts []discover.OptionF
+		want bool
+	}{
+		{name: "default share of misses", want: true},
+		{name: "fewer misses than the dangling copies", opts: []discover.OptionF{discover.WithEmbeddedIDMisses(0.1)}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := discover.New(ctx, f, tt.opts...)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			links, err := d.Database(ctx, "db")
+			if err != nil {
+				t.Fatalf("Database() error = %v", err)
+			}
+
+			if _, got := links["posts"]["author._id"]; got != tt.want {
+				t.Errorf("Database() = %v, want the link author._id: %v", links, tt.want)
+			}
+		})
+	}
+}
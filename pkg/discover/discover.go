@@ -2,8 +2,11 @@ package discover
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -12,6 +15,10 @@ import (
 const (
 	sampleSize = 100
 	primaryKey = "_id"
+	// defaultEmbeddedIDMisses is the share of the samples of a collection whose sub-document _id at a path may
+	// match no collection before the path is no longer probed, embedded entities have their own _ids and
+	// would be looked up in every collection
+	defaultEmbeddedIDMisses = 0.2
 )
 
 // Fetcher describes all methods needed by Discover
@@ -22,6 +29,90 @@ type Fetcher interface {
 	SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error)
 }
 
+// ErrUnsupported is returned by a decorator when the Fetcher it decorates lacks an optional method
+var ErrUnsupported = errors.New("unsupported by the Fetcher")
+
+// IndexLister is the optional Fetcher method set listing the indexes and counting the documents of a collection
+type IndexLister interface {
+	ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error)
+	EstimatedCount(ctx context.Context, db, collection string) (int64, error)
+}
+
+// ArrayCounter is the optional Fetcher method scanning a whole collection to count its arrays at a path by length
+type ArrayCounter interface {
+	ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error)
+}
+
+// IndexName returns the name of an index as listed by ListIndexes
+func IndexName(index primitive.D) string {
+	n, _ := index.Map()["name"].(string)
+	return n
+}
+
+// IndexKeys returns the keys of an index as listed by ListIndexes, in their order
+func IndexKeys(index primitive.D) primitive.D {
+	switch k := index.Map()["key"].(type) {
+	case primitive.D:
+		return k
+	case primitive.M:
+		// The order of a map is lost, it only matters for compound indexes
+		keys := primitive.D{}
+		for n, v := range k {
+			keys = append(keys, primitive.E{Key: n, Value: v})
+		}
+		return keys
+	default:
+		return primitive.D{}
+	}
+}
+
+// DotPath strips the array markers of a link path, giving the dotted path used by queries and indexes
+func DotPath(path string) string {
+	return strings.ReplaceAll(path, ".$", "")
+}
+
+// ValuesAt returns the values found at the link path in m, a $ goes through every element of an array
+func ValuesAt(m primitive.M, path string) []interface{} {
+	return valuesAt(m, strings.Split(path, "."))
+}
+
+func valuesAt(v interface{}, segments []string) []interface{} {
+	if len(segments) == 0 {
+		return []interface{}{v}
+	}
+
+	vs := []interface{}{}
+	switch t := v.(type) {
+	case primitive.M:
+		if e, ok := t[segments[0]]; ok {
+			vs = append(vs, valuesAt(e, segments[1:])...)
+		}
+	case primitive.D:
+		vs = append(vs, valuesAt(t.Map(), segments)...)
+	case primitive.A:
+		if segments[0] == "$" {
+			for _, e := range t {
+				vs = append(vs, valuesAt(e, segments[1:])...)
+			}
+		}
+	}
+
+	return vs
+}
+
+// ObjectIDOf returns the ObjectId held by v, either as such or as a hexadecimal string
+func ObjectIDOf(v interface{}) (primitive.ObjectID, bool) {
+	switch t := v.(type) {
+	case primitive.ObjectID:
+		return t, true
+	case string:
+		id, err := primitive.ObjectIDFromHex(t)
+		return id, err == nil
+	default:
+		return primitive.NilObjectID, false
+	}
+}
+
 type cacheExists struct {
 	*sync.RWMutex
 	m map[string]bool
@@ -32,31 +123,79 @@ type Discover struct {
 	cacheExists      cacheExists
 	Fetcher          Fetcher
 	collectionsByDbs map[string][]string
+	observer         Observer
+	sampleObserver   SampleObserver
+	logger           Logger
+	checkpoint       *Checkpoint
+	embeddedIDMisses float64
 }
 
-// New returns a new discover
-func New(ctx context.Context, r Fetcher) *Discover {
+// OptionF describes a func that will be called from the New func
+type OptionF func(*Discover)
+
+// WithObserver allows caller to follow the progress of a scan through events
+func WithObserver(o Observer) OptionF {
+	return func(d *Discover) {
+		d.observer = o
+	}
+}
+
+// WithSampleObserver makes o receive the documents sampled from every collection
+func WithSampleObserver(o SampleObserver) OptionF {
+	return func(d *Discover) {
+		d.sampleObserver = o
+	}
+}
+
+// WithLogger allows caller to receive the logs of Discover, which is quiet by default. A nil l keeps it quiet
+func WithLogger(l Logger) OptionF {
+	return func(d *Discover) {
+		if l == nil {
+			l = nopLogger{}
+		}
+		d.logger = l
+	}
+}
+
+// WithEmbeddedIDMisses sets the share of the samples of a collection whose sub-document _id at a path may match
+// no collection before the path is given up, 0.2 by default. A path matching once is always probed, 1 never gives up
+func WithEmbeddedIDMisses(share float64) OptionF {
+	return func(d *Discover) {
+		d.embeddedIDMisses = share
+	}
+}
+
+// New returns a new discover, it lists the databases and collections of r to know where IDs may live
+func New(ctx context.Context, r Fetcher, opts ...OptionF) (*Discover, error) {
 	clsByDb := make(map[string][]string)
 
 	dbs, err := r.ListDatabases(ctx)
 	if err != nil {
-		log.Fatalf("Error during listing databases: %s", err)
+		return nil, fmt.Errorf("Error during listing databases: %w", err)
 	}
 
 	for _, db := range dbs {
 		cls, err := r.ListCollections(ctx, db)
 		if err != nil {
-			log.Fatalf("Error during listing collection for %s: %s", db, err)
+			return nil, fmt.Errorf("Error during listing collection for %s: %w", db, err)
 		}
 
 		clsByDb[db] = cls
 	}
 
-	return &Discover{
+	d := &Discover{
 		Fetcher:          r,
 		cacheExists:      cacheExists{m: make(map[string]bool), RWMutex: &sync.RWMutex{}},
 		collectionsByDbs: clsByDb,
+		logger:           nopLogger{},
+		embeddedIDMisses: defaultEmbeddedIDMisses,
+	}
+
+	for _, o := range opts {
+		o(d)
 	}
+
+	return d, nil
 }
 
 // Link represents a path that leads to an ObjectId as a string
@@ -70,7 +209,8 @@ type Link struct {
 // CollectionLinks is a map with all Links found in the database
 type CollectionLinks map[string]Link
 
-// Linkify transforms an primitive.M to a slice of Link
+// Linkify transforms an primitive.M to a slice of Link.
+// The _id of the document is skipped, the one of a sub-document is a link as it's usually a copy of a referenced document
 func Linkify(m primitive.M, currentPath string) ([]Link, error) {
 	ls := []Link{}
 	var path string
@@ -79,7 +219,7 @@ func Linkify(m primitive.M, currentPath string) ([]Link, error) {
 	}
 
 	for p, v := range m {
-		if p == primaryKey {
+		if p == primaryKey && currentPath == "" {
 			continue
 		}
 
@@ -107,13 +247,20 @@ func Linkify(m primitive.M, currentPath string) ([]Link, error) {
 			}
 		} else if a, ok := v.(primitive.A); ok {
 			for _, el := range a {
-				if e, ok := el.(primitive.M); ok {
+				switch e := el.(type) {
+				case primitive.M:
 					subls, err := Linkify(e, fmt.Sprintf("%s%s.$", path, p))
 					if err != nil {
 						return ls, err
 					}
 
 					ls = append(ls, subls...)
+				case primitive.ObjectID:
+					ls = append(ls, Link{Path: path + p + ".$", Value: e.Hex()})
+				case string:
+					if _, err := primitive.ObjectIDFromHex(e); err == nil {
+						ls = append(ls, Link{Path: path + p + ".$", Value: e})
+					}
 				}
 			}
 		}
@@ -149,7 +296,8 @@ func (d Discover) matchLink(ctx context.Context, links []Link) ([]Link, error) {
 					defer wg.Done()
 					exists, err := d.existsByIDWithCache(withCancel, db, cl, l.Value)
 					if err != nil {
-						log.Printf("Error during existingID: %v\n", err)
+						d.logger.Warn("Error during existingID", "db", db, "collection", cl, "id", l.Value, "err", err)
+						d.notify(Event{Type: EventError, Database: db, Collection: cl, Path: l.Path, ID: l.Value, Err: err})
 						return
 					}
 
@@ -176,7 +324,8 @@ func (d Discover) matchLink(ctx context.Context, links []Link) ([]Link, error) {
 			nl.With = append(nl.With, p)
 			matchLs = append(matchLs, nl)
 		default:
-			log.Printf("Unknow OID: %s\n", link.Value)
+			d.logger.Debug("Unknown OID", "path", link.Path, "id", link.Value)
+			d.notify(Event{Type: EventUnknownOID, Path: link.Path, ID: link.Value})
 		}
 	}
 
@@ -232,19 +381,26 @@ func (d Discover) existsByIDWithCache(ctx context.Context, db string, c string,
 	d.cacheExists.RUnlock()
 
 	if ok {
+		d.notify(Event{Type: EventCacheHit, Database: db, Collection: c, ID: idStr})
 		return b, nil
 	}
 
 	id, err := primitive.ObjectIDFromHex(idStr)
 	if err != nil {
-		return false, fmt.Errorf("Error during ObjectId creation with value: %s, with: %s", id, err)
+		return false, fmt.Errorf("Error during ObjectId creation with value: %s, with: %w", idStr, err)
 	}
 
 	exists, err := d.Fetcher.ExistsByID(ctx, db, c, id)
+	d.notify(Event{Type: EventIDProbed, Database: db, Collection: c, ID: idStr})
 	if err != nil {
 		return false, fmt.Errorf("Error during searching %s in %s.%s with: %w", id.Hex(), db, c, err)
 	}
 
+	if ctx.Err() != nil {
+		// A canceled probe answers false without asking, it must not end up in the cache nor in a checkpoint
+		return exists, nil
+	}
+
 	d.cacheExists.Lock()
 	d.cacheExists.m[path] = exists
 	d.cacheExists.Unlock()
@@ -254,69 +410,222 @@ func (d Discover) existsByIDWithCache(ctx context.Context, db string, c string,
 
 // Collection retrieves all path that can be an ObjectId
 func (d Discover) Collection(ctx context.Context, db string, collection string) (CollectionLinks, error) {
+	d.notify(Event{Type: EventCollectionStarted, Database: db, Collection: collection})
+	cls, err := d.collection(ctx, db, collection)
+	if err != nil {
+		d.notify(Event{Type: EventError, Database: db, Collection: collection, Err: err})
+	}
+
+	d.notify(Event{Type: EventCollectionFinished, Database: db, Collection: collection, Count: len(cls)})
+	return cls, err
+}
+
+func (d Discover) collection(ctx context.Context, db string, collection string) (CollectionLinks, error) {
 	samples, err := d.Fetcher.SampleCollection(ctx, db, collection, sampleSize)
 	if err != nil {
-		log.Printf("Error during fetching sample of collection: %s db: %s with err: %s", collection, db, err)
-		return nil, fmt.Errorf("Error during fetching sample of collection: %s db: %s with err: %s", collection, db, err)
+		return nil, fmt.Errorf("Error during fetching sample of collection: %s db: %s with err: %w", collection, db, err)
 	}
 
+	d.notify(Event{Type: EventSamplesFetched, Database: db, Collection: collection, Count: len(samples)})
+	d.sampled(db, collection, samples)
+
 	lss := make([][]Link, 0, len(samples))
+	embedded := embeddedIDs{
+		max:     int(math.Ceil(d.embeddedIDMisses * float64(len(samples)))),
+		misses:  map[string]int{},
+		matched: map[string]bool{},
+	}
 
 	for _, m := range samples {
 		ls, err := Linkify(m, "")
 		if err != nil {
-			log.Printf("Error during Linkify %s", err)
-			return nil, fmt.Errorf("Error during Linkify %s", err)
+			return nil, fmt.Errorf("Error during Linkify: %w", err)
 		}
 
-		ls, err = d.matchLink(ctx, ls)
-		lss = append(lss, ls)
+		ls = embedded.probed(ls)
+		matched, err := d.matchLink(ctx, ls)
+		lss = append(lss, matched)
 		if err != nil {
 			return nil, fmt.Errorf("Error during MatchLink for %s.%s with: %w", db, collection, err)
 		}
+		for _, p := range embedded.record(ls, matched) {
+			d.logger.Info("Sub-document _id path no longer probed, it matched nothing", "db", db, "collection", collection, "path", p, "misses", embedded.max)
+		}
 	}
 
 	return reduceLinks(lss)
 }
 
-// Database returns all links about all collections inside a Database
+// embeddedIDs tracks the sub-document _id paths of a collection that never matched
+type embeddedIDs struct {
+	// max is the number of misses after which a path is given up
+	max     int
+	misses  map[string]int
+	matched map[string]bool
+}
+
+func isEmbeddedID(path string) bool {
+	return strings.HasSuffix(path, "."+primaryKey)
+}
+
+// probed drops the links of ls at the sub-document _id paths that missed too often without ever matching
+func (e embeddedIDs) probed(ls []Link) []Link {
+	kept := ls[:0]
+	for _, l := range ls {
+		if isEmbeddedID(l.Path) && !e.matched[l.Path] && e.misses[l.Path] >= e.max {
+			continue
+		}
+		kept = append(kept, l)
+	}
+
+	return kept
+}
+
+// record counts a miss for every sub-document _id path of ls that has no link in matched,
+// it returns the paths given up by this miss
+func (e embeddedIDs) record(ls, matched []Link) []string {
+	found := map[string]bool{}
+	for _, l := range matched {
+		found[l.Path] = true
+	}
+
+	missed := map[string]bool{}
+	for _, l := range ls {
+		if !isEmbeddedID(l.Path) {
+			continue
+		}
+		if found[l.Path] {
+			e.matched[l.Path] = true
+		} else {
+			missed[l.Path] = true
+		}
+	}
+	givenUp := []string{}
+	for p := range missed {
+		e.misses[p]++
+		if !e.matched[p] && e.misses[p] == e.max {
+			givenUp = append(givenUp, p)
+		}
+	}
+	sort.Strings(givenUp)
+
+	return givenUp
+}
+
+// resample fetches a new sample of a collection resumed from a checkpoint for the sample observer, which gets
+// nothing otherwise. It's cheap next to probing the IDs, a failure only costs the observer this collection
+func (d Discover) resample(ctx context.Context, db, collection string) {
+	if d.sampleObserver == nil {
+		return
+	}
+
+	samples, err := d.Fetcher.SampleCollection(ctx, db, collection, sampleSize)
+	if err != nil {
+		d.logger.Warn("Error during sampling a resumed collection", "db", db, "collection", collection, "err", err)
+		d.notify(Event{Type: EventError, Database: db, Collection: collection, Err: err})
+		return
+	}
+
+	d.notify(Event{Type: EventSamplesFetched, Database: db, Collection: collection, Count: len(samples)})
+	d.sampled(db, collection, samples)
+}
+
+// CollectionFailure describes why a collection could not be scanned
+type CollectionFailure struct {
+	Collection string
+	Err        error
+}
+
+// ScanError is returned by Database alongside the links of all collections that succeeded
+type ScanError struct {
+	Database string
+	Failures []CollectionFailure
+}
+
+func (e *ScanError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Error during scanning %d collections of %s:", len(e.Failures), e.Database)
+	for _, f := range e.Failures {
+		fmt.Fprintf(&b, " %s: %v;", f.Collection, f.Err)
+	}
+
+	return b.String()
+}
+
+// Database returns all links about all collections inside a Database.
+// When some collections fail, the links of the others are returned with a *ScanError listing the failures
 func (d Discover) Database(ctx context.Context, db string) (map[string]CollectionLinks, error) {
-	log.Println("Starting...")
+	d.logger.Info("Starting...", "db", db)
+	if d.checkpoint != nil {
+		if err := d.checkpoint.check(db); err != nil {
+			return nil, err
+		}
+	}
+
 	cls, err := d.Fetcher.ListCollections(ctx, db)
 	if err != nil {
 		return nil, fmt.Errorf("Error during ListCollections(): %w", err)
 	}
 
-	log.Printf("Found %d collections for %s\n", len(cls), db)
+	d.logger.Info("Found collections", "db", db, "count", len(cls))
+	d.notify(Event{Type: EventScanStarted, Database: db, Count: len(cls)})
 	mCls := map[string]CollectionLinks{}
 	ch := make(chan work, len(cls))
 	w := sync.WaitGroup{}
 
 	for _, cl := range cls {
 		c := cl
+		if d.checkpoint != nil {
+			if cm, ok := d.checkpoint.completed(c); ok {
+				d.logger.Info("Collection resumed from checkpoint", "db", db, "collection", c)
+				d.notify(Event{Type: EventCollectionResumed, Database: db, Collection: c, Count: len(cm)})
+				d.resample(ctx, db, c)
+				ch <- work{path: c, cm: cm}
+				continue
+			}
+		}
+
 		w.Add(1)
 		go func() {
 			defer w.Done()
 			cm, err := d.Collection(ctx, db, c)
 			if err != nil {
-				log.Printf("Error during scanning Collection(%s.%s): %v", db, c, err)
+				d.logger.Error("Error during scanning Collection", "db", db, "collection", c, "err", err)
+			} else if d.checkpoint != nil {
+				if err := d.checkpoint.save(c, cm, d.cacheExists); err != nil {
+					d.logger.Error("Error during saving checkpoint", "db", db, "collection", c, "err", err)
+					d.notify(Event{Type: EventError, Database: db, Collection: c, Err: err})
+				}
 			}
-			ch <- work{path: c, cm: cm}
-			log.Printf("%s.%s done!\n", db, c)
+			ch <- work{path: c, cm: cm, err: err}
+			d.logger.Info("Collection done", "db", db, "collection", c)
 		}()
 	}
 
 	w.Wait()
 	close(ch)
+	failures := []CollectionFailure{}
 	for w := range ch {
+		if w.err != nil {
+			failures = append(failures, CollectionFailure{Collection: w.path, Err: w.err})
+			continue
+		}
+
 		mCls[w.path] = w.cm
 	}
 
-	log.Printf("%d ObjectId scanned !\n", len(d.cacheExists.m))
+	d.logger.Info("ObjectIds scanned", "db", db, "count", len(d.cacheExists.m))
+	d.notify(Event{Type: EventScanFinished, Database: db, Count: len(d.cacheExists.m)})
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].Collection < failures[j].Collection })
+		return mCls, &ScanError{Database: db, Failures: failures}
+	}
+
 	return mCls, nil
 }
 
 type work struct {
 	cm   CollectionLinks
 	path string
+	err  error
 }
@@ -40,6 +40,14 @@ func TestLinkify(t *testing.T) {
 			name: "nested case",
 			args: args{currentPath: "", m: primitive.M{"keyField": "valueField", "eeeee": primitive.M{"testId": oid1}}},
 			want: []Link{{Path: "eeeee.testId", Value: oid1.Hex()}},
+		}, {
+			name: "_id of a sub-document",
+			args: args{currentPath: "", m: primitive.M{"_id": oid1, "customer": primitive.M{"_id": oid2, "name": "n"}, "lines": primitive.A{primitive.M{"_id": oid3}}}},
+			want: []Link{{Path: "customer._id", Value: oid2.Hex()}, {Path: "lines.$._id", Value: oid3.Hex()}},
+		}, {
+			name: "array of ids",
+			args: args{currentPath: "", m: primitive.M{"bIds": primitive.A{oid1, oid2.Hex(), "notAnId", int32(4)}}},
+			want: []Link{{Path: "bIds.$", Value: oid1.Hex()}, {Path: "bIds.$", Value: oid2.Hex()}},
 		}, {
 			name: "multiple case",
 			args: args{currentPath: "", m: primitive.M{"keyField": "valueField", "eeeee1": oid1, "aaaaaaaa2": oid2}},
@@ -240,7 +248,10 @@ func TestMatchLink(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			defer tt.ctrl.Finish()
-			d := New(tt.args.ctx, tt.fields.fetcher)
+			d, err := New(tt.args.ctx, tt.fields.fetcher)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
 
 			got, err := d.matchLink(tt.args.ctx, tt.args.ls)
 			if err != nil {
@@ -415,7 +426,10 @@ func TestDiscover_Collection(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			d := New(tt.args.ctx, tt.fields.fetcher)
+			d, err := New(tt.args.ctx, tt.fields.fetcher)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
 			got, err := d.Collection(tt.args.ctx, tt.args.db, tt.args.collection)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("Discover.Collection() error = %v, wantErr %v", err, tt.wantErr)
@@ -435,3 +449,31 @@ func sortLinkInPlace(ls []Link) []Link {
 
 	return ls
 }
+
+func TestValuesAt(t *testing.T) {
+	m := primitive.M{
+		"a":     int32(1),
+		"owner": primitive.D{{Key: "id", Value: "x"}},
+		"items": primitive.A{primitive.M{"id": "y"}, primitive.M{"other": "z"}, primitive.M{"id": "w"}},
+		"grid":  primitive.A{primitive.A{int32(1), int32(2)}, primitive.A{int32(3)}},
+	}
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"a", []interface{}{int32(1)}},
+		{"owner.id", []interface{}{"x"}},
+		{"items.$.id", []interface{}{"y", "w"}},
+		{"grid.$.$", []interface{}{int32(1), int32(2), int32(3)}},
+		{"items.id", []interface{}{}},
+		{"missing", []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := ValuesAt(m, tt.path); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ValuesAt() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package discover
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EventType identifies what happened during a scan
+type EventType string
+
+const (
+	// EventScanStarted is emitted once Database knows how many collections it will scan
+	EventScanStarted EventType = "scan_started"
+	// EventScanFinished is emitted when Database is done with all collections
+	EventScanFinished EventType = "scan_finished"
+	// EventCollectionStarted is emitted before a collection is sampled
+	EventCollectionStarted EventType = "collection_started"
+	// EventCollectionFinished is emitted when all links of a collection are reduced
+	EventCollectionFinished EventType = "collection_finished"
+	// EventCollectionResumed is emitted instead of started/finished when a collection is taken from a checkpoint
+	EventCollectionResumed EventType = "collection_resumed"
+	// EventSamplesFetched is emitted when the sample of a collection is received
+	EventSamplesFetched EventType = "samples_fetched"
+	// EventIDProbed is emitted each time the Fetcher is asked for the existence of an ID
+	EventIDProbed EventType = "id_probed"
+	// EventCacheHit is emitted when the existence of an ID is answered by the cache
+	EventCacheHit EventType = "cache_hit"
+	// EventUnknownOID is emitted when an ID does not match any collection
+	EventUnknownOID EventType = "unknown_oid"
+	// EventError is emitted for every error encountered during a scan, even the ones that are not returned
+	EventError EventType = "error"
+)
+
+// Event describes a step of a scan, only the fields relevant to its Type are set
+type Event struct {
+	Type       EventType
+	Time       time.Time
+	Database   string
+	Collection string
+	Path       string
+	ID         string
+	Count      int
+	Err        error
+}
+
+// MarshalJSON flattens Err into a string so events can be streamed as JSON
+func (e Event) MarshalJSON() ([]byte, error) {
+	var errStr string
+	if e.Err != nil {
+		errStr = e.Err.Error()
+	}
+
+	return json.Marshal(struct {
+		Type       EventType `json:"type"`
+		Time       time.Time `json:"time"`
+		Database   string    `json:"database,omitempty"`
+		Collection string    `json:"collection,omitempty"`
+		Path       string    `json:"path,omitempty"`
+		ID         string    `json:"id,omitempty"`
+		Count      int       `json:"count,omitempty"`
+		Err        string    `json:"error,omitempty"`
+	}{e.Type, e.Time, e.Database, e.Collection, e.Path, e.ID, e.Count, errStr})
+}
+
+// Observer receives the events of a scan.
+// Notify is called concurrently from all the goroutines of a scan so it must be safe for concurrent use
+type Observer interface {
+	Notify(e Event)
+}
+
+// SampleObserver receives the documents sampled from each collection.
+// Unlike Events they hold production data, so they only reach the observers asking for them.
+// Samples is called concurrently like Notify
+type SampleObserver interface {
+	Samples(db, collection string, samples []primitive.M)
+}
+
+// ObserverFunc allows a plain func to be used as an Observer
+type ObserverFunc func(e Event)
+
+// Notify calls f(e)
+func (f ObserverFunc) Notify(e Event) {
+	f(e)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Notify(e Event) {
+	for _, o := range m {
+		o.Notify(e)
+	}
+}
+
+// Observers returns an Observer that forwards every event to all os
+func Observers(os ...Observer) Observer {
+	return multiObserver(os)
+}
+
+type jsonObserver struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONObserver returns an Observer that writes every event as a JSON line on w
+func NewJSONObserver(w io.Writer) Observer {
+	return &jsonObserver{enc: json.NewEncoder(w)}
+}
+
+func (o *jsonObserver) Notify(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	// An observer has no way to report an error, a broken stream must not break the scan
+	_ = o.enc.Encode(e)
+}
+
+// sampled sends the samples of db.collection to the sample observer of d if any
+func (d Discover) sampled(db, collection string, samples []primitive.M) {
+	if d.sampleObserver != nil {
+		d.sampleObserver.Samples(db, collection, samples)
+	}
+}
+
+// notify timestamps e and sends it to the observer of d if any
+func (d Discover) notify(e Event) {
+	if d.observer == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	d.observer.Notify(e)
+}
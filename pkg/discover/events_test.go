@@ -0,0 +1,94 @@
+package discover_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sampleRecorder counts the documents it receives by collection
+type sampleRecorder struct {
+	mu      sync.Mutex
+	sampled map[string]int
+}
+
+func (r *sampleRecorder) Samples(db, collection string, samples []primitive.M) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sampled[collection] += len(samples)
+}
+
+func TestDatabase_Events(t *testing.T) {
+	ctx := context.Background()
+	a := primitive.NewObjectID()
+	f := inmem.New(0).
+		Insert("db", "A", primitive.M{"_id": a}).
+		Insert("db", "B", primitive.M{"_id": primitive.NewObjectID(), "aId": a, "ghostId": primitive.NewObjectID()})
+
+	var mu sync.Mutex
+	counts := map[discover.EventType]int{}
+	types := []discover.EventType{}
+	o := discover.ObserverFunc(func(e discover.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[e.Type]++
+		types = append(types, e.Type)
+	})
+
+	sr := &sampleRecorder{sampled: map[string]int{}}
+	d, err := discover.New(ctx, f, discover.WithObserver(o), discover.WithSampleObserver(sr))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := d.Database(ctx, "db"); err != nil {
+		t.Fatalf("Database() error = %v", err)
+	}
+
+	want := map[discover.EventType]int{
+		discover.EventScanStarted:        1,
+		discover.EventCollectionStarted:  2,
+		discover.EventSamplesFetched:     2,
+		discover.EventCollectionFinished: 2,
+		discover.EventScanFinished:       1,
+		discover.EventUnknownOID:         1,
+	}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("%d %s events, want %d", counts[typ], typ, n)
+		}
+	}
+	if sr.sampled["A"] != 1 || sr.sampled["B"] != 1 {
+		t.Errorf("sample observer received %v, want a document of A and B", sr.sampled)
+	}
+	if types[0] != discover.EventScanStarted || types[len(types)-1] != discover.EventScanFinished {
+		t.Errorf("events = %v, want scan_started first and scan_finished last", types)
+	}
+}
+
+func TestJSONObserver(t *testing.T) {
+	var b bytes.Buffer
+	o := discover.Observers(discover.NewJSONObserver(&b), discover.ObserverFunc(func(discover.Event) {}))
+	o.Notify(discover.Event{Type: discover.EventSamplesFetched, Database: "db", Collection: "users", Count: 1})
+	o.Notify(discover.Event{Type: discover.EventError, Collection: "users", Err: errors.New("boom")})
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(lines), b.String())
+	}
+
+	e := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[1]), &e); err != nil {
+		t.Fatalf("line %s is not JSON: %v", lines[1], err)
+	}
+	if e["type"] != "error" || e["error"] != "boom" || e["collection"] != "users" {
+		t.Errorf("error event = %v, want its error flattened", e)
+	}
+}
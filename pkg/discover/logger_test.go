@@ -0,0 +1,70 @@
+package discover_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// recordingLogger keeps the messages it receives by level
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs map[string][]string
+}
+
+func (l *recordingLogger) log(level, msg string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs[level] = append(l.msgs[level], fmt.Sprint(append([]interface{}{msg}, args...)...))
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.log("debug", msg, args...) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.log("info", msg, args...) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.log("warn", msg, args...) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.log("error", msg, args...) }
+
+// failingFetcher fails to list the databases
+type failingFetcher struct {
+	*inmem.Fetcher
+}
+
+func (failingFetcher) ListDatabases(context.Context) ([]string, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestWithLogger(t *testing.T) {
+	ctx := context.Background()
+	f := inmem.New(0).Insert("db", "A", primitive.M{"_id": primitive.NewObjectID()})
+
+	l := &recordingLogger{msgs: map[string][]string{}}
+	d, err := discover.New(ctx, f, discover.WithLogger(l))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := d.Database(ctx, "db"); err != nil {
+		t.Fatalf("Database() error = %v", err)
+	}
+	if len(l.msgs["info"]) == 0 {
+		t.Errorf("no info log received, got %v", l.msgs)
+	}
+
+	d, err = discover.New(ctx, f, discover.WithLogger(nil))
+	if err != nil {
+		t.Fatalf("New() with a nil logger error = %v", err)
+	}
+	if _, err := d.Database(ctx, "db"); err != nil {
+		t.Fatalf("Database() with a nil logger error = %v", err)
+	}
+}
+
+func TestNew_Error(t *testing.T) {
+	if _, err := discover.New(context.Background(), failingFetcher{inmem.New(0)}); err == nil {
+		t.Errorf("New() error = nil, want the listing error")
+	}
+}
@@ -3,8 +3,12 @@ package discover
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -12,7 +16,10 @@ import (
 
 // Repository contains all methods to access to Mongodb
 type Repository struct {
-	client *mongo.Client
+	client      *mongo.Client
+	readPref    *readpref.ReadPref
+	readConcern *readconcern.ReadConcern
+	maxTime     time.Duration
 }
 
 // RepositoryOptionF describes a func that will be called from the New func
@@ -25,6 +32,28 @@ func RepositoryWithClient(c *mongo.Client) RepositoryOptionF {
 	}
 }
 
+// RepositoryWithReadPreference sends every read to the members selected by rp, e.g. secondaries to spare the primary.
+// The read preference of the client is used by default
+func RepositoryWithReadPreference(rp *readpref.ReadPref) RepositoryOptionF {
+	return func(r *Repository) {
+		r.readPref = rp
+	}
+}
+
+// RepositoryWithReadConcern sets the read concern of every read, the one of the client is used by default
+func RepositoryWithReadConcern(rc *readconcern.ReadConcern) RepositoryOptionF {
+	return func(r *Repository) {
+		r.readConcern = rc
+	}
+}
+
+// RepositoryWithMaxTime makes the server abort every query running longer than d, 0 lets them run
+func RepositoryWithMaxTime(d time.Duration) RepositoryOptionF {
+	return func(r *Repository) {
+		r.maxTime = d
+	}
+}
+
 // NewRepository creates a new Repository
 func NewRepository(opts ...RepositoryOptionF) *Repository {
 	r := &Repository{}
@@ -36,11 +65,56 @@ func NewRepository(opts ...RepositoryOptionF) *Repository {
 	return r
 }
 
+// database returns db with the read preference and concern of r
+func (r Repository) database(db string) *mongo.Database {
+	return r.client.Database(db, options.Database().SetReadPreference(r.readPref).SetReadConcern(r.readConcern))
+}
+
+// find returns the options of a find, limited by the max time of r
+func (r Repository) find() *options.FindOptions {
+	o := options.Find()
+	if r.maxTime > 0 {
+		o.SetMaxTime(r.maxTime)
+	}
+
+	return o
+}
+
+// aggregate returns the options of an aggregation, limited by the max time of r
+func (r Repository) aggregate() *options.AggregateOptions {
+	o := options.Aggregate()
+	if r.maxTime > 0 {
+		o.SetMaxTime(r.maxTime)
+	}
+
+	return o
+}
+
+// listIndexes returns the options of a listing of indexes, limited by the max time of r
+func (r Repository) listIndexes() *options.ListIndexesOptions {
+	o := options.ListIndexes()
+	if r.maxTime > 0 {
+		o.SetMaxTime(r.maxTime)
+	}
+
+	return o
+}
+
+// estimatedCount returns the options of an estimated count, limited by the max time of r
+func (r Repository) estimatedCount() *options.EstimatedDocumentCountOptions {
+	o := options.EstimatedDocumentCount()
+	if r.maxTime > 0 {
+		o.SetMaxTime(r.maxTime)
+	}
+
+	return o
+}
+
 // ExistsByID tests the existence of a document by its ID in a specific database collection
 func (r Repository) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
-	c, err := r.client.Database(db).Collection(collection).Find(ctx,
+	c, err := r.database(db).Collection(collection).Find(ctx,
 		primitive.M{"_id": id},
-		options.Find().SetProjection(primitive.M{"_id": 1}).SetLimit(1),
+		r.find().SetProjection(primitive.M{"_id": 1}).SetLimit(1),
 	)
 
 	if err != nil {
@@ -57,19 +131,46 @@ func (r Repository) ExistsByID(ctx context.Context, db, collection string, id pr
 
 // ListDatabases will return all database names that client can access
 func (r Repository) ListDatabases(ctx context.Context) ([]string, error) {
-	return r.client.ListDatabaseNames(ctx, primitive.M{})
+	// The command is run by hand as ListDatabaseNames takes neither a read preference nor a max time
+	cmd := primitive.D{{Key: "listDatabases", Value: 1}, {Key: "nameOnly", Value: true}}
+	if r.maxTime > 0 {
+		cmd = append(cmd, primitive.E{Key: "maxTimeMS", Value: r.maxTime.Milliseconds()})
+	}
+
+	// The read concern of r is left out, listDatabases takes none
+	admin := r.client.Database("admin")
+	rp := r.readPref
+	if rp == nil {
+		rp = admin.ReadPreference()
+	}
+
+	res := struct {
+		Databases []struct {
+			Name string `bson:"name"`
+		} `bson:"databases"`
+	}{}
+	if err := admin.RunCommand(ctx, cmd, options.RunCmd().SetReadPreference(rp)).Decode(&res); err != nil {
+		return nil, fmt.Errorf("Error during listing databases: %w", err)
+	}
+
+	names := make([]string, 0, len(res.Databases))
+	for _, d := range res.Databases {
+		names = append(names, d.Name)
+	}
+
+	return names, nil
 }
 
 // ListCollections will return all collection names for a specific db
 func (r Repository) ListCollections(ctx context.Context, db string) ([]string, error) {
-	return r.client.Database(db).ListCollectionNames(ctx, primitive.M{})
+	return r.database(db).ListCollectionNames(ctx, primitive.M{})
 }
 
 // SampleCollection returns a random sample of a specific size from a specific db.collection
 func (r Repository) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
-	c, err := r.client.Database(db).Collection(collection).Aggregate(ctx, primitive.A{
+	c, err := r.database(db).Collection(collection).Aggregate(ctx, primitive.A{
 		primitive.D{{Key: "$sample", Value: primitive.D{{Key: "size", Value: size}}}},
-	}, options.Aggregate().SetAllowDiskUse(true))
+	}, r.aggregate().SetAllowDiskUse(true))
 
 	if err != nil {
 		return nil, fmt.Errorf("Error during sampling: %w", err)
@@ -80,3 +181,179 @@ func (r Repository) SampleCollection(ctx context.Context, db, collection string,
 
 	return results, err
 }
+
+// ListIndexes returns all indexes of a specific db.collection
+func (r Repository) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	c, err := r.database(db).Collection(collection).Indexes().List(ctx, r.listIndexes())
+	if err != nil {
+		return nil, fmt.Errorf("Error during listing indexes of %s.%s: %w", db, collection, err)
+	}
+
+	indexes := []primitive.D{}
+	err = c.All(ctx, &indexes)
+
+	return indexes, err
+}
+
+// EstimatedCount returns the number of documents of a specific db.collection from its metadata
+func (r Repository) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	return r.database(db).Collection(collection).EstimatedDocumentCount(ctx, r.estimatedCount())
+}
+
+// ArrayLengths counts the arrays found at the link path of every document of db.collection by length,
+// with a $size aggregation going through the arrays before the last one
+func (r Repository) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	pipeline := primitive.A{}
+	segments := strings.Split(path, ".")
+	for i, s := range segments {
+		if s == "$" {
+			pipeline = append(pipeline, primitive.M{"$unwind": "$" + DotPath(strings.Join(segments[:i], "."))})
+		}
+	}
+
+	dotted := DotPath(path)
+	pipeline = append(pipeline,
+		primitive.M{"$match": primitive.M{dotted: primitive.M{"$type": "array"}}},
+		primitive.M{"$group": primitive.M{"_id": primitive.M{"$size": "$" + dotted}, "n": primitive.M{"$sum": 1}}},
+	)
+
+	c, err := r.database(db).Collection(collection).Aggregate(ctx, pipeline, r.aggregate())
+	if err != nil {
+		return nil, fmt.Errorf("Error during measuring arrays %s of %s.%s: %w", path, db, collection, err)
+	}
+
+	groups := []struct {
+		Length int `bson:"_id"`
+		N      int `bson:"n"`
+	}{}
+	if err := c.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("Error during measuring arrays %s of %s.%s: %w", path, db, collection, err)
+	}
+
+	lengths := map[int]int{}
+	for _, g := range groups {
+		lengths[g.Length] = g.N
+	}
+
+	return lengths, nil
+}
+
+// FindReferencing returns the _id of the documents of db.collection holding one of ids at the link path,
+// as an ObjectId or as its hexadecimal string
+func (r Repository) FindReferencing(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]interface{}, error) {
+	values := make(primitive.A, 0, 2*len(ids))
+	for _, id := range ids {
+		values = append(values, id, id.Hex())
+	}
+
+	c, err := r.database(db).Collection(collection).Find(ctx,
+		primitive.M{DotPath(path): primitive.M{"$in": values}},
+		r.find().SetProjection(primitive.M{"_id": 1}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error during finding references to %s.%s: %w", collection, path, err)
+	}
+
+	docs := []primitive.M{}
+	if err := c.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("Error during finding references to %s.%s: %w", collection, path, err)
+	}
+
+	found := make([]interface{}, 0, len(docs))
+	for _, d := range docs {
+		found = append(found, d["_id"])
+	}
+
+	return found, nil
+}
+
+// Referenced returns the ids held at the link path by some document of db.collection,
+// as an ObjectId or as its hexadecimal string
+func (r Repository) Referenced(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	values := make(primitive.A, 0, 2*len(ids))
+	set := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		values = append(values, id, id.Hex())
+		set[id] = struct{}{}
+	}
+
+	// The matching documents are unwound down to the referencing values and grouped by value,
+	// so the answer holds at most the asked ids where a distinct could exceed the 16MB of a document
+	dotted := DotPath(path)
+	in := primitive.M{dotted: primitive.M{"$in": values}}
+	pipeline := primitive.A{primitive.M{"$match": in}}
+	segments := strings.Split(path, ".")
+	for i, s := range segments {
+		if s == "$" {
+			pipeline = append(pipeline, primitive.M{"$unwind": "$" + DotPath(strings.Join(segments[:i], "."))})
+		}
+	}
+	pipeline = append(pipeline,
+		primitive.M{"$match": in},
+		primitive.M{"$group": primitive.M{"_id": "$" + dotted}},
+	)
+
+	c, err := r.database(db).Collection(collection).Aggregate(ctx, pipeline, r.aggregate())
+	if err != nil {
+		return nil, fmt.Errorf("Error during finding references of %s.%s: %w", collection, path, err)
+	}
+
+	groups := []struct {
+		Value interface{} `bson:"_id"`
+	}{}
+	if err := c.All(ctx, &groups); err != nil {
+		return nil, fmt.Errorf("Error during finding references of %s.%s: %w", collection, path, err)
+	}
+
+	found := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+	for _, g := range groups {
+		id, ok := ObjectIDOf(g.Value)
+		if _, wanted := set[id]; ok && wanted && !seen[id] {
+			seen[id] = true
+			found = append(found, id)
+		}
+	}
+
+	return found, nil
+}
+
+// FindByIDs returns the documents of db.collection whose _id is one of ids
+func (r Repository) FindByIDs(ctx context.Context, db, collection string, ids []primitive.ObjectID) ([]primitive.M, error) {
+	c, err := r.database(db).Collection(collection).Find(ctx, primitive.M{primaryKey: primitive.M{"$in": ids}}, r.find())
+	if err != nil {
+		return nil, fmt.Errorf("Error during finding documents of %s.%s: %w", db, collection, err)
+	}
+
+	docs := []primitive.M{}
+	if err := c.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("Error during finding documents of %s.%s: %w", db, collection, err)
+	}
+
+	return docs, nil
+}
+
+// Each streams every document of db.collection to fn, stopping at the first error
+func (r Repository) Each(ctx context.Context, db, collection string, fn func(m primitive.M) error) error {
+	c, err := r.database(db).Collection(collection).Find(ctx, primitive.M{}, r.find())
+	if err != nil {
+		return fmt.Errorf("Error during reading %s.%s: %w", db, collection, err)
+	}
+	defer c.Close(ctx)
+
+	for c.Next(ctx) {
+		m := primitive.M{}
+		if err := c.Decode(&m); err != nil {
+			return fmt.Errorf("Error during decoding a document of %s.%s: %w", db, collection, err)
+		}
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Err(); err != nil {
+		return fmt.Errorf("Error during reading %s.%s: %w", db, collection, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,252 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+const (
+	defaultRetryAttempts   = 4
+	defaultRetryBackoff    = 100 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+)
+
+// retryableCodes are the server error codes that the driver itself considers as transient
+var retryableCodes = []int32{6, 7, 89, 91, 189, 262, 9001, 10107, 11600, 11602, 13435, 13436}
+
+// RetryFetcher decorates a Fetcher with per-call timeouts and retries with an exponential backoff
+type RetryFetcher struct {
+	next        Fetcher
+	attempts    int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	timeout     time.Duration
+	isRetryable func(error) bool
+}
+
+// RetryOptionF describes a func that will be called from the NewRetryFetcher func
+type RetryOptionF func(*RetryFetcher)
+
+// RetryWithAttempts sets how many times a call is tried before giving up, 1 disables retries
+func RetryWithAttempts(n int) RetryOptionF {
+	return func(r *RetryFetcher) {
+		r.attempts = n
+	}
+}
+
+// RetryWithBackoff sets the first delay between two attempts, doubled after each attempt up to max
+func RetryWithBackoff(initial, max time.Duration) RetryOptionF {
+	return func(r *RetryFetcher) {
+		r.backoff = initial
+		r.maxBackoff = max
+	}
+}
+
+// RetryWithTimeout bounds each attempt, 0 means that only the caller's context applies
+func RetryWithTimeout(d time.Duration) RetryOptionF {
+	return func(r *RetryFetcher) {
+		r.timeout = d
+	}
+}
+
+// RetryWithClassifier replaces IsRetryable to decide which errors deserve another attempt
+func RetryWithClassifier(f func(error) bool) RetryOptionF {
+	return func(r *RetryFetcher) {
+		r.isRetryable = f
+	}
+}
+
+// NewRetryFetcher creates a new RetryFetcher around f
+func NewRetryFetcher(f Fetcher, opts ...RetryOptionF) *RetryFetcher {
+	r := &RetryFetcher{
+		next:        f,
+		attempts:    defaultRetryAttempts,
+		backoff:     defaultRetryBackoff,
+		maxBackoff:  defaultRetryMaxBackoff,
+		isRetryable: IsRetryable,
+	}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// IsRetryable reports whether err looks like a transient failure of the cluster or of the network
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		if ce.HasErrorLabel("NetworkError") || ce.HasErrorLabel("RetryableWriteError") || ce.HasErrorLabel("TransientTransactionError") {
+			return true
+		}
+
+		for _, c := range retryableCodes {
+			if ce.Code == c {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	var conErr topology.ConnectionError
+	if errors.As(err, &conErr) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// do calls f until it succeeds, fails with a non retryable error or attempts are exhausted
+func (r RetryFetcher) do(ctx context.Context, f func(ctx context.Context) error) error {
+	backoff := r.backoff
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		err = r.try(ctx, f)
+		if err == nil || attempt >= r.attempts || ctx.Err() != nil || !r.isRetryable(err) {
+			return err
+		}
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+func (r RetryFetcher) try(ctx context.Context, f func(ctx context.Context) error) error {
+	if r.timeout <= 0 {
+		return f(ctx)
+	}
+
+	withTimeout, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	return f(withTimeout)
+}
+
+// ExistsByID calls ExistsByID of the decorated Fetcher
+func (r RetryFetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	var exists bool
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		exists, err = r.next.ExistsByID(ctx, db, collection, id)
+		return err
+	})
+
+	return exists, err
+}
+
+// ListDatabases calls ListDatabases of the decorated Fetcher
+func (r RetryFetcher) ListDatabases(ctx context.Context) ([]string, error) {
+	var dbs []string
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		dbs, err = r.next.ListDatabases(ctx)
+		return err
+	})
+
+	return dbs, err
+}
+
+// ListCollections calls ListCollections of the decorated Fetcher
+func (r RetryFetcher) ListCollections(ctx context.Context, db string) ([]string, error) {
+	var cls []string
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		cls, err = r.next.ListCollections(ctx, db)
+		return err
+	})
+
+	return cls, err
+}
+
+// SampleCollection calls SampleCollection of the decorated Fetcher
+func (r RetryFetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	var ms []primitive.M
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		ms, err = r.next.SampleCollection(ctx, db, collection, size)
+		return err
+	})
+
+	return ms, err
+}
+
+// ListIndexes calls ListIndexes of the decorated Fetcher, ErrUnsupported when it has none
+func (r RetryFetcher) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	l, ok := r.next.(IndexLister)
+	if !ok {
+		return nil, fmt.Errorf("ListIndexes: %w", ErrUnsupported)
+	}
+
+	var indexes []primitive.D
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		indexes, err = l.ListIndexes(ctx, db, collection)
+		return err
+	})
+
+	return indexes, err
+}
+
+// EstimatedCount calls EstimatedCount of the decorated Fetcher, ErrUnsupported when it has none
+func (r RetryFetcher) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	l, ok := r.next.(IndexLister)
+	if !ok {
+		return 0, fmt.Errorf("EstimatedCount: %w", ErrUnsupported)
+	}
+
+	var n int64
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		n, err = l.EstimatedCount(ctx, db, collection)
+		return err
+	})
+
+	return n, err
+}
+
+// ArrayLengths calls ArrayLengths of the decorated Fetcher, ErrUnsupported when it has none
+func (r RetryFetcher) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	c, ok := r.next.(ArrayCounter)
+	if !ok {
+		return nil, fmt.Errorf("ArrayLengths: %w", ErrUnsupported)
+	}
+
+	var lengths map[int]int
+	err := r.do(ctx, func(ctx context.Context) error {
+		var err error
+		lengths, err = c.ArrayLengths(ctx, db, collection, path)
+		return err
+	})
+
+	return lengths, err
+}
@@ -0,0 +1,86 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/flowHater/mongo-inferer/pkg/mock_discover"
+)
+
+func TestRetryFetcher_SampleCollection(t *testing.T) {
+	transient := mongo.CommandError{Code: 189, Name: "PrimarySteppedDown"}
+	fatal := mongo.CommandError{Code: 13, Name: "Unauthorized"}
+	sample := []primitive.M{{"_id": primitive.NewObjectID()}}
+
+	tests := []struct {
+		name    string
+		errs    []error
+		want    []primitive.M
+		wantErr bool
+	}{
+		{name: "nominal case - no error", errs: []error{nil}, want: sample},
+		{name: "transient errors are retried", errs: []error{transient, transient, nil}, want: sample},
+		{name: "attempts are exhausted", errs: []error{transient, transient, transient}, wantErr: true},
+		{name: "non retryable error is returned at once", errs: []error{fatal}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			fetcher := mock_discover.NewMockFetcher(ctrl)
+			calls := []*gomock.Call{}
+			for _, err := range tt.errs {
+				var ms []primitive.M
+				if err == nil {
+					ms = sample
+				}
+				calls = append(calls, fetcher.EXPECT().SampleCollection(gomock.AssignableToTypeOf(withCancelCtx), "db", "cl", sampleSize).Return(ms, err))
+			}
+			gomock.InOrder(calls...)
+
+			r := NewRetryFetcher(fetcher, RetryWithAttempts(3), RetryWithBackoff(time.Millisecond, time.Millisecond))
+			got, err := r.SampleCollection(context.Background(), "db", "cl", sampleSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RetryFetcher.SampleCollection() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RetryFetcher.SampleCollection() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "wrapped deadline", err: fmt.Errorf("Error during sampling: %w", context.DeadlineExceeded), want: true},
+		{name: "network label", err: mongo.CommandError{Labels: []string{"NetworkError"}}, want: true},
+		{name: "not master", err: mongo.CommandError{Code: 10107}, want: true},
+		{name: "unauthorized", err: mongo.CommandError{Code: 13}, want: false},
+		{name: "canceled", err: context.Canceled, want: false},
+		{name: "random error", err: errors.New("boom"), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
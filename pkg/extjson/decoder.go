@@ -0,0 +1,105 @@
+package extjson
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Decoder streams canonical or relaxed Extended JSON documents, written either as a single array
+// (mongoexport --jsonArray) or one after another (mongoexport default)
+type Decoder struct {
+	br      *bufio.Reader
+	dec     *json.Decoder
+	inArray bool
+	n       int
+}
+
+// NewDecoder creates a Decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{br: bufio.NewReader(r)}
+}
+
+// Next returns the next document, io.EOF is returned once all documents are read
+func (d *Decoder) Next() (primitive.M, error) {
+	if d.dec == nil {
+		if err := d.start(); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.inArray && !d.dec.More() {
+		return nil, io.EOF
+	}
+
+	var raw json.RawMessage
+	if err := d.dec.Decode(&raw); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("Error during reading document %d: %w", d.n, err)
+	}
+
+	m := primitive.M{}
+	if err := bson.UnmarshalExtJSON(raw, false, &m); err != nil {
+		return nil, fmt.Errorf("Error during decoding document %d: %w", d.n, err)
+	}
+	d.n++
+
+	return m, nil
+}
+
+// start looks at the first significant rune to know if documents are wrapped in an array
+func (d *Decoder) start() error {
+	for {
+		r, _, err := d.br.ReadRune()
+		if err == io.EOF {
+			d.dec = json.NewDecoder(d.br)
+			return io.EOF
+		}
+		if err != nil {
+			return fmt.Errorf("Error during reading Extended JSON: %w", err)
+		}
+
+		if unicode.IsSpace(r) || r == '\uFEFF' {
+			continue
+		}
+
+		if err := d.br.UnreadRune(); err != nil {
+			return err
+		}
+		break
+	}
+
+	d.dec = json.NewDecoder(d.br)
+	if b, _ := d.br.Peek(1); len(b) == 1 && b[0] == '[' {
+		if _, err := d.dec.Token(); err != nil {
+			return fmt.Errorf("Error during reading Extended JSON array: %w", err)
+		}
+		d.inArray = true
+	}
+
+	return nil
+}
+
+// Decode reads all documents of r
+func Decode(r io.Reader) ([]primitive.M, error) {
+	d := NewDecoder(r)
+	docs := []primitive.M{}
+
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return docs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		docs = append(docs, m)
+	}
+}
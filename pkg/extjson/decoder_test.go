@@ -0,0 +1,82 @@
+package extjson
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDecode(t *testing.T) {
+	oid, _ := primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e1f")
+
+	tests := []struct {
+		name  string
+		input string
+		want  []primitive.M
+	}{
+		{
+			name:  "one document per line",
+			input: "{\"_id\":{\"$oid\":\"5f1b2c3d4e5f6a7b8c9d0e1f\"},\"n\":1}\n{\"ref\":{\"$oid\":\"5f1b2c3d4e5f6a7b8c9d0e1f\"}}\n",
+			want:  []primitive.M{{"_id": oid, "n": int32(1)}, {"ref": oid}},
+		}, {
+			name:  "array of canonical documents",
+			input: `[{"n":{"$numberLong":"5"}},{"sub":{"ref":{"$oid":"5f1b2c3d4e5f6a7b8c9d0e1f"}}}]`,
+			want:  []primitive.M{{"n": int64(5)}, {"sub": primitive.M{"ref": oid}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetcher(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "extjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	oid, _ := primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e1f")
+	if err := os.Mkdir(filepath.Join(dir, "db"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"A.json": ` [{"_id":{"$oid":"5f1b2c3d4e5f6a7b8c9d0e1f"}}]`,
+		"B.json": "{\"_id\":{\"$oid\":\"5f1b2c3d4e5f6a7b8c9d0e20\"},\"aId\":{\"$oid\":\"5f1b2c3d4e5f6a7b8c9d0e1f\"}}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, "db", name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := NewFetcher(dir, 1)
+	if cls, _ := f.ListCollections(ctx, "db"); !reflect.DeepEqual(cls, []string{"A", "B"}) {
+		t.Errorf("Fetcher.ListCollections() = %v, want [A B]", cls)
+	}
+	if exists, err := f.ExistsByID(ctx, "db", "A", oid); err != nil || !exists {
+		t.Errorf("Fetcher.ExistsByID() = %v, %v, want true", exists, err)
+	}
+	if exists, err := f.ExistsByID(ctx, "db", "B", oid); err != nil || exists {
+		t.Errorf("Fetcher.ExistsByID() = %v, %v, want false", exists, err)
+	}
+	if sample, err := f.SampleCollection(ctx, "db", "B", 10); err != nil || len(sample) != 1 || sample[0]["aId"] != oid {
+		t.Errorf("Fetcher.SampleCollection() = %v, %v", sample, err)
+	}
+}
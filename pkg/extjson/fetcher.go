@@ -0,0 +1,289 @@
+package extjson
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	primaryKey = "_id"
+	extension  = ".json"
+)
+
+// Fetcher is a discover.Fetcher reading mongoexport files laid out as <dir>/<db>/<collection>.json
+type Fetcher struct {
+	dir  string
+	seed int64
+
+	mu      sync.Mutex
+	indexes map[string]*index
+}
+
+// index holds the _id of a collection, it is built on the first ExistsByID
+type index struct {
+	once sync.Once
+	ids  map[primitive.ObjectID]struct{}
+	err  error
+}
+
+// NewFetcher creates a Fetcher over dir, seed makes SampleCollection deterministic
+func NewFetcher(dir string, seed int64) *Fetcher {
+	return &Fetcher{dir: dir, seed: seed, indexes: map[string]*index{}}
+}
+
+func (f *Fetcher) path(db, collection string) string {
+	return filepath.Join(f.dir, db, collection+extension)
+}
+
+// each calls fn for every document of db.collection, for the scans that can't fail
+func (f *Fetcher) each(db, collection string, fn func(m primitive.M)) error {
+	return f.Each(context.Background(), db, collection, func(m primitive.M) error {
+		fn(m)
+		return nil
+	})
+}
+
+// Each decodes db.collection and calls fn for every document, stopping at the first error.
+// A missing file has no document
+func (f *Fetcher) Each(ctx context.Context, db, collection string, fn func(m primitive.M) error) error {
+	r, err := os.Open(f.path(db, collection))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error during opening %s.%s: %w", db, collection, err)
+	}
+	defer r.Close()
+
+	d := NewDecoder(r)
+	for {
+		m, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Error during reading %s.%s: %w", db, collection, err)
+		}
+
+		if err := fn(m); err != nil {
+			return err
+		}
+	}
+}
+
+// ExistsByID tests the existence of a document by its ID, the _id index of the collection is built on the first call
+func (f *Fetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	f.mu.Lock()
+	idx, ok := f.indexes[db+"."+collection]
+	if !ok {
+		idx = &index{}
+		f.indexes[db+"."+collection] = idx
+	}
+	f.mu.Unlock()
+
+	idx.once.Do(func() {
+		idx.ids = map[primitive.ObjectID]struct{}{}
+		idx.err = f.each(db, collection, func(m primitive.M) {
+			if id, ok := m[primaryKey].(primitive.ObjectID); ok {
+				idx.ids[id] = struct{}{}
+			}
+		})
+	})
+
+	if idx.err != nil {
+		return false, idx.err
+	}
+
+	_, ok = idx.ids[id]
+	return ok, nil
+}
+
+// ListDatabases returns the sub directories of dir
+func (f *Fetcher) ListDatabases(ctx context.Context) ([]string, error) {
+	infos, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return nil, fmt.Errorf("Error during listing databases in %s: %w", f.dir, err)
+	}
+
+	dbs := []string{}
+	for _, i := range infos {
+		if i.IsDir() {
+			dbs = append(dbs, i.Name())
+		}
+	}
+	sort.Strings(dbs)
+
+	return dbs, nil
+}
+
+// ListCollections returns the .json files of the db directory without their extension
+func (f *Fetcher) ListCollections(ctx context.Context, db string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(f.dir, db))
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error during listing collections of %s: %w", db, err)
+	}
+
+	cls := []string{}
+	for _, i := range infos {
+		if !i.IsDir() && strings.HasSuffix(i.Name(), extension) {
+			cls = append(cls, strings.TrimSuffix(i.Name(), extension))
+		}
+	}
+	sort.Strings(cls)
+
+	return cls, nil
+}
+
+// SampleCollection picks size documents of db.collection with a reservoir so the file is streamed only once.
+// The result only depends on the seed, db and collection
+func (f *Fetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	h := fnv.New64a()
+	h.Write([]byte(db + "." + collection))
+	rnd := rand.New(rand.NewSource(f.seed ^ int64(h.Sum64())))
+
+	sample := []primitive.M{}
+	seen := 0
+	err := f.each(db, collection, func(m primitive.M) {
+		seen++
+		if len(sample) < size {
+			sample = append(sample, m)
+			return
+		}
+
+		if j := rnd.Intn(seen); j < size {
+			sample[j] = m
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sample, nil
+}
+
+// ListIndexes returns the _id_ index of db.collection since mongoexport files do not carry the other ones
+func (f *Fetcher) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	_, err := os.Stat(f.path(db, collection))
+	if os.IsNotExist(err) {
+		return []primitive.D{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error during listing indexes of %s.%s: %w", db, collection, err)
+	}
+
+	return []primitive.D{{{Key: "v", Value: int32(2)}, {Key: "key", Value: primitive.D{{Key: primaryKey, Value: int32(1)}}}, {Key: "name", Value: "_id_"}}}, nil
+}
+
+// EstimatedCount counts the documents of db.collection by streaming its file
+func (f *Fetcher) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	var n int64
+	err := f.each(db, collection, func(m primitive.M) {
+		n++
+	})
+
+	return n, err
+}
+
+// ArrayLengths streams db.collection and counts the arrays found at the link path by length
+func (f *Fetcher) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	lengths := map[int]int{}
+	err := f.each(db, collection, func(m primitive.M) {
+		for _, v := range discover.ValuesAt(m, path) {
+			if a, ok := v.(primitive.A); ok {
+				lengths[len(a)]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return lengths, nil
+}
+
+// Referenced streams db.collection and returns the ids held at the link path by some document
+func (f *Fetcher) Referenced(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	set := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	found := []primitive.ObjectID{}
+	err := f.each(db, collection, func(m primitive.M) {
+		for _, v := range discover.ValuesAt(m, path) {
+			if id, ok := discover.ObjectIDOf(v); ok {
+				if _, ok := set[id]; ok {
+					delete(set, id)
+					found = append(found, id)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// FindReferencing streams db.collection and returns the _id of the documents holding one of ids at the link path
+func (f *Fetcher) FindReferencing(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]interface{}, error) {
+	set := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	found := []interface{}{}
+	err := f.each(db, collection, func(m primitive.M) {
+		for _, v := range discover.ValuesAt(m, path) {
+			if id, ok := discover.ObjectIDOf(v); ok {
+				if _, ok := set[id]; ok {
+					found = append(found, m[primaryKey])
+					return
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return found, nil
+}
+
+// FindByIDs streams db.collection and returns the documents whose _id is one of ids
+func (f *Fetcher) FindByIDs(ctx context.Context, db, collection string, ids []primitive.ObjectID) ([]primitive.M, error) {
+	set := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	docs := []primitive.M{}
+	err := f.each(db, collection, func(m primitive.M) {
+		if id, ok := m[primaryKey].(primitive.ObjectID); ok {
+			if _, ok := set[id]; ok {
+				docs = append(docs, m)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return docs, nil
+}
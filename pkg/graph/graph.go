@@ -0,0 +1,332 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+// ErrCycle is returned when collections reference each other so no order can put every target first
+var ErrCycle = errors.New("the links contain a cycle")
+
+// Edge is every link of a collection to another one
+type Edge struct {
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Paths []string `json:"paths"`
+}
+
+// Graph is the directed graph of the links, nodes are db.collection and an edge goes from a collection to what it references
+type Graph struct {
+	nodes map[string]struct{}
+	out   map[string]map[string][]string
+	in    map[string]map[string]struct{}
+}
+
+// New builds the Graph of the links discovered in db, targets in other databases become nodes too
+func New(db string, links map[string]discover.CollectionLinks) *Graph {
+	g := &Graph{nodes: map[string]struct{}{}, out: map[string]map[string][]string{}, in: map[string]map[string]struct{}{}}
+
+	for c, cl := range links {
+		from := db + "." + c
+		g.addNode(from)
+
+		for _, l := range cl {
+			for _, to := range l.With {
+				g.addNode(to)
+				g.out[from][to] = append(g.out[from][to], l.Path)
+				g.in[to][from] = struct{}{}
+			}
+		}
+	}
+
+	for _, tos := range g.out {
+		for _, paths := range tos {
+			sort.Strings(paths)
+		}
+	}
+
+	return g
+}
+
+func (g *Graph) addNode(n string) {
+	if _, ok := g.nodes[n]; ok {
+		return
+	}
+
+	g.nodes[n] = struct{}{}
+	g.out[n] = map[string][]string{}
+	g.in[n] = map[string]struct{}{}
+}
+
+// Nodes returns all collections sorted
+func (g *Graph) Nodes() []string {
+	return sortedKeys(g.nodes)
+}
+
+// Edges returns all edges sorted by origin then target
+func (g *Graph) Edges() []Edge {
+	es := []Edge{}
+	for _, from := range g.Nodes() {
+		for _, to := range g.Out(from) {
+			es = append(es, Edge{From: from, To: to, Paths: g.out[from][to]})
+		}
+	}
+
+	return es
+}
+
+// Out returns the collections referenced by n sorted
+func (g *Graph) Out(n string) []string {
+	tos := make([]string, 0, len(g.out[n]))
+	for to := range g.out[n] {
+		tos = append(tos, to)
+	}
+	sort.Strings(tos)
+
+	return tos
+}
+
+// In returns the collections referencing n sorted
+func (g *Graph) In(n string) []string {
+	return sortedKeys(g.in[n])
+}
+
+// Roots returns the collections referencing others that nothing references, a self reference aside
+func (g *Graph) Roots() []string {
+	rs := []string{}
+	for _, n := range g.Nodes() {
+		if g.degree(g.in[n], n) == 0 && g.outDegree(n) > 0 {
+			rs = append(rs, n)
+		}
+	}
+
+	return rs
+}
+
+// Leaves returns the referenced collections that reference nothing, a self reference aside
+func (g *Graph) Leaves() []string {
+	ls := []string{}
+	for _, n := range g.Nodes() {
+		if g.outDegree(n) == 0 && g.degree(g.in[n], n) > 0 {
+			ls = append(ls, n)
+		}
+	}
+
+	return ls
+}
+
+// Orphans returns the collections that neither reference nor are referenced by another collection
+func (g *Graph) Orphans() []string {
+	orphans := []string{}
+	for _, n := range g.Nodes() {
+		if g.outDegree(n) == 0 && g.degree(g.in[n], n) == 0 {
+			orphans = append(orphans, n)
+		}
+	}
+
+	return orphans
+}
+
+func (g *Graph) degree(set map[string]struct{}, self string) int {
+	d := len(set)
+	if _, ok := set[self]; ok {
+		d--
+	}
+
+	return d
+}
+
+func (g *Graph) outDegree(n string) int {
+	d := len(g.out[n])
+	if _, ok := g.out[n][n]; ok {
+		d--
+	}
+
+	return d
+}
+
+// StronglyConnectedComponents returns the groups of collections that can all reach each other,
+// every group and the list of groups sorted
+func (g *Graph) StronglyConnectedComponents() [][]string {
+	t := tarjan{g: g, index: map[string]int{}, low: map[string]int{}, onStack: map[string]bool{}}
+	for _, n := range g.Nodes() {
+		if _, ok := t.index[n]; !ok {
+			t.visit(n)
+		}
+	}
+
+	sort.Slice(t.sccs, func(i, j int) bool {
+		return t.sccs[i][0] < t.sccs[j][0]
+	})
+
+	return t.sccs
+}
+
+// Cycles returns the components whose collections reference each other, including a collection referencing itself
+func (g *Graph) Cycles() [][]string {
+	cs := [][]string{}
+	for _, scc := range g.StronglyConnectedComponents() {
+		if _, self := g.out[scc[0]][scc[0]]; len(scc) > 1 || self {
+			cs = append(cs, scc)
+		}
+	}
+
+	return cs
+}
+
+// LoadOrder returns the components in an order where every collection comes after the ones it references,
+// collections of a same component reference each other and must be loaded together
+func (g *Graph) LoadOrder() [][]string {
+	sccs := g.StronglyConnectedComponents()
+	component := map[string]int{}
+	for i, scc := range sccs {
+		for _, n := range scc {
+			component[n] = i
+		}
+	}
+
+	// pending holds the components each component still waits for, waiting the ones waiting for it
+	pending := make([]map[int]struct{}, len(sccs))
+	waiting := make([]map[int]struct{}, len(sccs))
+	for i := range sccs {
+		pending[i] = map[int]struct{}{}
+		waiting[i] = map[int]struct{}{}
+	}
+	for from, tos := range g.out {
+		for to := range tos {
+			if cf, ct := component[from], component[to]; cf != ct {
+				pending[cf][ct] = struct{}{}
+				waiting[ct][cf] = struct{}{}
+			}
+		}
+	}
+
+	ready := []int{}
+	for i := range sccs {
+		if len(pending[i]) == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	order := make([][]string, 0, len(sccs))
+	for len(ready) > 0 {
+		// Components are sorted by their first collection so the smallest index is the first name
+		sort.Ints(ready)
+		c := ready[0]
+		ready = ready[1:]
+		order = append(order, sccs[c])
+
+		for w := range waiting[c] {
+			delete(pending[w], c)
+			if len(pending[w]) == 0 {
+				ready = append(ready, w)
+			}
+		}
+	}
+
+	return order
+}
+
+// TopologicalOrder returns the collections in an order where every collection comes after the ones it references.
+// A collection referencing itself does not prevent it, collections referencing each other return ErrCycle
+func (g *Graph) TopologicalOrder() ([]string, error) {
+	order := []string{}
+	cycles := []string{}
+	for _, c := range g.LoadOrder() {
+		if len(c) > 1 {
+			cycles = append(cycles, "["+strings.Join(c, ", ")+"]")
+		}
+		order = append(order, c...)
+	}
+
+	if len(cycles) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCycle, strings.Join(cycles, ", "))
+	}
+
+	return order, nil
+}
+
+// Report gathers every analysis of a Graph
+type Report struct {
+	Collections []string   `json:"collections"`
+	Edges       []Edge     `json:"edges"`
+	Roots       []string   `json:"roots"`
+	Leaves      []string   `json:"leaves"`
+	Orphans     []string   `json:"orphans"`
+	Cycles      [][]string `json:"cycles"`
+	LoadOrder   [][]string `json:"loadOrder"`
+}
+
+// Report runs every analysis of g
+func (g *Graph) Report() Report {
+	return Report{
+		Collections: g.Nodes(),
+		Edges:       g.Edges(),
+		Roots:       g.Roots(),
+		Leaves:      g.Leaves(),
+		Orphans:     g.Orphans(),
+		Cycles:      g.Cycles(),
+		LoadOrder:   g.LoadOrder(),
+	}
+}
+
+// tarjan finds the strongly connected components with the algorithm of Tarjan
+type tarjan struct {
+	g       *Graph
+	next    int
+	index   map[string]int
+	low     map[string]int
+	stack   []string
+	onStack map[string]bool
+	sccs    [][]string
+}
+
+func (t *tarjan) visit(n string) {
+	t.index[n] = t.next
+	t.low[n] = t.next
+	t.next++
+	t.stack = append(t.stack, n)
+	t.onStack[n] = true
+
+	for _, to := range t.g.Out(n) {
+		if _, ok := t.index[to]; !ok {
+			t.visit(to)
+			if t.low[to] < t.low[n] {
+				t.low[n] = t.low[to]
+			}
+		} else if t.onStack[to] && t.index[to] < t.low[n] {
+			t.low[n] = t.index[to]
+		}
+	}
+
+	if t.low[n] != t.index[n] {
+		return
+	}
+
+	scc := []string{}
+	for {
+		top := t.stack[len(t.stack)-1]
+		t.stack = t.stack[:len(t.stack)-1]
+		t.onStack[top] = false
+		scc = append(scc, top)
+		if top == n {
+			break
+		}
+	}
+	sort.Strings(scc)
+	t.sccs = append(t.sccs, scc)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	ks := make([]string, 0, len(set))
+	for k := range set {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+
+	return ks
+}
@@ -0,0 +1,57 @@
+package graph
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+func link(path string, with ...string) discover.Link {
+	return discover.Link{Path: path, With: with}
+}
+
+func TestGraph(t *testing.T) {
+	links := map[string]discover.CollectionLinks{
+		"orders":     {"userId": link("userId", "db.users"), "lines.$.itemId": link("lines.$.itemId", "db.items")},
+		"users":      {"teamId": link("teamId", "db.teams")},
+		"teams":      {"ownerId": link("ownerId", "db.users")},
+		"items":      {"parentId": link("parentId", "db.items")},
+		"categories": {},
+		"logs":       {"vendorId": link("vendorId", "erp.vendors")},
+	}
+	g := New("db", links)
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"Roots", g.Roots(), []string{"db.logs", "db.orders"}},
+		{"Leaves", g.Leaves(), []string{"db.items", "erp.vendors"}},
+		{"Orphans", g.Orphans(), []string{"db.categories"}},
+		{"Cycles", g.Cycles(), [][]string{{"db.items"}, {"db.teams", "db.users"}}},
+		{"LoadOrder", g.LoadOrder(), [][]string{{"db.categories"}, {"db.items"}, {"db.teams", "db.users"}, {"db.orders"}, {"erp.vendors"}, {"db.logs"}}},
+		{"Out", g.Out("db.orders"), []string{"db.items", "db.users"}},
+		{"In", g.In("db.users"), []string{"db.orders", "db.teams"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("Graph.%s() = %v, want %v", tt.name, tt.got, tt.want)
+			}
+		})
+	}
+
+	if _, err := g.TopologicalOrder(); !errors.Is(err, ErrCycle) {
+		t.Errorf("Graph.TopologicalOrder() error = %v, want ErrCycle", err)
+	}
+
+	delete(links, "teams")
+	order, err := New("db", links).TopologicalOrder()
+	want := []string{"db.categories", "db.items", "db.teams", "db.users", "db.orders", "erp.vendors", "db.logs"}
+	if err != nil || !reflect.DeepEqual(order, want) {
+		t.Errorf("Graph.TopologicalOrder() = %v, %v, want %v", order, err, want)
+	}
+}
@@ -0,0 +1,185 @@
+package growth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+// Default thresholds, far below the 16MB limit of a document that an array of ObjectIds hits around 800000 elements
+// but where updating and loading the whole document already gets slow
+const (
+	defaultWarning  = 1000
+	defaultCritical = 10000
+)
+
+// All the levels of an array
+const (
+	LevelOK       = "ok"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// Array is an array holding references
+type Array struct {
+	Collection string `json:"collection"`
+	// Path is the link path of the array and Links the link paths of the references it holds
+	Path  string   `json:"path"`
+	Links []string `json:"links"`
+	// Sampled summarises the lengths of the sampled arrays, Scanned the ones of the whole collection when it was scanned
+	Sampled schema.Distribution  `json:"sampled"`
+	Scanned *schema.Distribution `json:"scanned,omitempty"`
+	Level   string               `json:"level"`
+}
+
+// Max returns the longest array found, scanned or sampled
+func (a Array) Max() int {
+	if a.Scanned != nil && a.Scanned.Max > a.Sampled.Max {
+		return a.Scanned.Max
+	}
+
+	return a.Sampled.Max
+}
+
+// OptionF describes a func that will be called from the Analyze func
+type OptionF func(*analyzer)
+
+// WithThresholds sets the lengths from which an array is a warning and critical, 1000 and 10000 by default
+func WithThresholds(warning, critical int) OptionF {
+	return func(a *analyzer) {
+		a.warning, a.critical = warning, critical
+	}
+}
+
+// WithScan measures the arrays of the whole collections with c, only the samples are measured by default
+func WithScan(c discover.ArrayCounter) OptionF {
+	return func(a *analyzer) {
+		a.counter = c
+	}
+}
+
+type analyzer struct {
+	warning  int
+	critical int
+	counter  discover.ArrayCounter
+}
+
+// Analyze measures every array holding a link of db, schemas are the ones inferred from the samples.
+// The longest arrays come first
+func Analyze(ctx context.Context, db string, schemas map[string]*schema.Document, links map[string]discover.CollectionLinks, opts ...OptionF) ([]Array, error) {
+	a := analyzer{warning: defaultWarning, critical: defaultCritical}
+	for _, o := range opts {
+		o(&a)
+	}
+
+	arrays := []Array{}
+	for c, cl := range links {
+		byPath := map[string]*Array{}
+		paths := []string{}
+		for _, l := range cl {
+			for _, p := range arrayPaths(l.Path) {
+				arr, ok := byPath[p]
+				if !ok {
+					arr = &Array{Collection: c, Path: p}
+					byPath[p] = arr
+					paths = append(paths, p)
+				}
+				arr.Links = append(arr.Links, l.Path)
+			}
+		}
+		sort.Strings(paths)
+
+		for _, p := range paths {
+			arr := byPath[p]
+			sort.Strings(arr.Links)
+
+			if f := schemas[c].FieldAt(p); f != nil {
+				arr.Sampled = f.LengthDistribution()
+			}
+
+			if a.counter != nil {
+				lengths, err := a.counter.ArrayLengths(ctx, db, c, p)
+				if err != nil {
+					return nil, fmt.Errorf("Error during measuring %s.%s: %w", c, p, err)
+				}
+				d := schema.NewDistribution(lengths)
+				arr.Scanned = &d
+			}
+
+			arr.Level = a.level(arr.Max())
+			arrays = append(arrays, *arr)
+		}
+	}
+
+	sort.Slice(arrays, func(i, j int) bool {
+		if arrays[i].Max() != arrays[j].Max() {
+			return arrays[i].Max() > arrays[j].Max()
+		}
+		if arrays[i].Collection != arrays[j].Collection {
+			return arrays[i].Collection < arrays[j].Collection
+		}
+
+		return arrays[i].Path < arrays[j].Path
+	})
+
+	return arrays, nil
+}
+
+func (a analyzer) level(max int) string {
+	switch {
+	case max >= a.critical:
+		return LevelCritical
+	case max >= a.warning:
+		return LevelWarning
+	default:
+		return LevelOK
+	}
+}
+
+// arrayPaths returns the link paths of the arrays a link path goes through, a.$.b.$ goes through a and a.$.b
+func arrayPaths(path string) []string {
+	ps := []string{}
+	segments := strings.Split(path, ".")
+	for i, s := range segments {
+		if s == "$" && i > 0 {
+			ps = append(ps, strings.Join(segments[:i], "."))
+		}
+	}
+
+	return ps
+}
+
+// Write prints arrays as a table, the sampled and scanned lengths side by side
+func Write(w io.Writer, db string, arrays []Array) error {
+	if len(arrays) == 0 {
+		_, err := fmt.Fprintf(w, "No link of %s is held by an array.\n", db)
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LEVEL\tARRAY\tSAMPLED min/median/p99/max\tSCANNED min/median/p99/max\tLINKS")
+	for _, a := range arrays {
+		scanned := "-"
+		if a.Scanned != nil {
+			scanned = lengths(*a.Scanned)
+		}
+
+		fmt.Fprintf(tw, "%s\t%s.%s\t%s\t%s\t%s\n", a.Level, a.Collection, a.Path, lengths(a.Sampled), scanned, strings.Join(a.Links, ", "))
+	}
+
+	return tw.Flush()
+}
+
+func lengths(d schema.Distribution) string {
+	if d.Count == 0 {
+		return "no array"
+	}
+
+	return fmt.Sprintf("%d/%d/%d/%d over %d", d.Min, d.Median, d.P99, d.Max, d.Count)
+}
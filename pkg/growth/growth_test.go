@@ -0,0 +1,69 @@
+package growth
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func ids(n int) primitive.A {
+	a := primitive.A{}
+	for i := 0; i < n; i++ {
+		a = append(a, primitive.NewObjectID())
+	}
+
+	return a
+}
+
+func TestAnalyze(t *testing.T) {
+	ctx := context.Background()
+	sampled := []primitive.M{
+		{"bIds": ids(1), "lines": primitive.A{primitive.M{"tagIds": ids(2)}}},
+		{"bIds": ids(2), "lines": primitive.A{}},
+	}
+	f := inmem.New(0).Insert("db", "C", sampled...).Insert("db", "C", primitive.M{"bIds": ids(12)})
+	links := map[string]discover.CollectionLinks{
+		"C": {
+			"bIds.$":            {Path: "bIds.$", With: []string{"db.B"}},
+			"lines.$.tagIds.$":  {Path: "lines.$.tagIds.$", With: []string{"db.T"}},
+			"lines.$.productId": {Path: "lines.$.productId", With: []string{"db.P"}},
+		},
+		"B": {"aId": {Path: "aId", With: []string{"db.A"}}},
+	}
+	schemas := map[string]*schema.Document{"C": schema.Infer(sampled)}
+
+	got, err := Analyze(ctx, "db", schemas, links, WithThresholds(2, 10), WithScan(f))
+	if err != nil {
+		t.Fatalf("Analyze() error = %v", err)
+	}
+
+	want := []Array{
+		{Collection: "C", Path: "bIds", Links: []string{"bIds.$"}, Level: LevelCritical,
+			Sampled: schema.Distribution{Count: 2, Min: 1, Median: 1, P99: 2, Max: 2, Mean: 1.5},
+			Scanned: &schema.Distribution{Count: 3, Min: 1, Median: 2, P99: 12, Max: 12, Mean: 5}},
+		{Collection: "C", Path: "lines.$.tagIds", Links: []string{"lines.$.tagIds.$"}, Level: LevelWarning,
+			Sampled: schema.Distribution{Count: 1, Min: 2, Median: 2, P99: 2, Max: 2, Mean: 2},
+			Scanned: &schema.Distribution{Count: 1, Min: 2, Median: 2, P99: 2, Max: 2, Mean: 2}},
+		{Collection: "C", Path: "lines", Links: []string{"lines.$.productId", "lines.$.tagIds.$"}, Level: LevelOK,
+			Sampled: schema.Distribution{Count: 2, Min: 0, Median: 0, P99: 1, Max: 1, Mean: 0.5},
+			Scanned: &schema.Distribution{Count: 2, Min: 0, Median: 0, P99: 1, Max: 1, Mean: 0.5}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Analyze() = %+v, want %+v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, "db", got); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if line := strings.Split(b.String(), "\n")[1]; !strings.HasPrefix(line, "critical") || !strings.Contains(line, "1/2/12/12 over 3") {
+		t.Errorf("Write() = %s, want C.bIds first and critical", b.String())
+	}
+}
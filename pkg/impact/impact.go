@@ -0,0 +1,360 @@
+package impact
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const defaultBatchSize = 1000
+
+// Finder finds the IDs of the documents of a collection holding one of ids at path, each level of the impact tree is one call
+type Finder interface {
+	FindReferencing(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]interface{}, error)
+}
+
+// Node is a set of documents of a collection, the ones referencing the documents of the parent Node through Path
+type Node struct {
+	// Collection is db.collection
+	Collection string `json:"collection"`
+	// Path is the link path of Collection referencing the parent, "" for the root
+	Path     string        `json:"path,omitempty"`
+	IDs      []interface{} `json:"ids"`
+	Children []*Node       `json:"children,omitempty"`
+}
+
+// Count returns the number of distinct documents of n and its descendants
+func (n *Node) Count() int {
+	docs := map[string]struct{}{}
+	n.documents(docs)
+
+	return len(docs)
+}
+
+func (n *Node) documents(docs map[string]struct{}) {
+	for _, id := range n.IDs {
+		docs[n.Collection+"|"+idKey(id)] = struct{}{}
+	}
+	for _, c := range n.Children {
+		c.documents(docs)
+	}
+}
+
+// reference is a link of a collection of db to a target
+type reference struct {
+	collection string
+	path       string
+}
+
+// Analyzer walks the links discovered in a database backwards
+type Analyzer struct {
+	f         Finder
+	db        string
+	batchSize int
+	// reverse holds by db.collection the links referencing it
+	reverse map[string][]reference
+}
+
+// OptionF describes a func that will be called from the NewAnalyzer func
+type OptionF func(*Analyzer)
+
+// WithBatchSize sets how many IDs each query looks for, 1000 by default
+func WithBatchSize(n int) OptionF {
+	return func(a *Analyzer) {
+		a.batchSize = n
+	}
+}
+
+// NewAnalyzer creates an Analyzer of the links discovered in db, documents are looked up with f
+func NewAnalyzer(f Finder, db string, links map[string]discover.CollectionLinks, opts ...OptionF) *Analyzer {
+	a := &Analyzer{f: f, db: db, batchSize: defaultBatchSize, reverse: map[string][]reference{}}
+	for _, o := range opts {
+		o(a)
+	}
+	if a.batchSize < 1 {
+		a.batchSize = 1
+	}
+
+	for c, cl := range links {
+		for _, l := range cl {
+			for _, w := range l.With {
+				a.reverse[w] = append(a.reverse[w], reference{collection: c, path: l.Path})
+			}
+		}
+	}
+
+	for _, refs := range a.reverse {
+		sort.Slice(refs, func(i, j int) bool {
+			if refs[i].collection != refs[j].collection {
+				return refs[i].collection < refs[j].collection
+			}
+
+			return refs[i].path < refs[j].path
+		})
+	}
+
+	return a
+}
+
+// Impact returns the tree of the documents referencing id of target, a db.collection, and what references them
+// until depth. A document referencing through several paths is listed under each but its references are followed once
+func (a *Analyzer) Impact(ctx context.Context, target string, id primitive.ObjectID, depth int) (*Node, error) {
+	root := &Node{Collection: target, IDs: []interface{}{id}}
+	seen := map[string]map[string]struct{}{target: {idKey(id): {}}}
+
+	// follow holds the documents of each node whose references are still to find
+	follow := map[*Node][]primitive.ObjectID{root: {id}}
+	level := []*Node{root}
+	for d := 0; d < depth && len(level) > 0; d++ {
+		next := []*Node{}
+		for _, n := range level {
+			ids := follow[n]
+			if len(ids) == 0 {
+				continue
+			}
+
+			for _, r := range a.reverse[n.Collection] {
+				found, err := a.find(ctx, r, ids)
+				if err != nil {
+					return nil, err
+				}
+				if len(found) == 0 {
+					continue
+				}
+
+				c := a.db + "." + r.collection
+				if seen[c] == nil {
+					seen[c] = map[string]struct{}{}
+				}
+
+				child := &Node{Collection: c, Path: r.path, IDs: found}
+				for _, f := range found {
+					k := idKey(f)
+					if _, ok := seen[c][k]; ok {
+						continue
+					}
+					seen[c][k] = struct{}{}
+					if oid, ok := f.(primitive.ObjectID); ok {
+						follow[child] = append(follow[child], oid)
+					}
+				}
+
+				n.Children = append(n.Children, child)
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+
+	return root, nil
+}
+
+// find returns the documents referencing ids through r, looked up batch by batch.
+// A document referencing IDs of several batches is returned once
+func (a *Analyzer) find(ctx context.Context, r reference, ids []primitive.ObjectID) ([]interface{}, error) {
+	found := []interface{}{}
+	seen := map[string]struct{}{}
+	for start := 0; start < len(ids); start += a.batchSize {
+		end := start + a.batchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		batch, err := a.f.FindReferencing(ctx, a.db, r.collection, r.path, ids[start:end])
+		if err != nil {
+			return nil, fmt.Errorf("Error during finding references from %s.%s: %w", r.collection, r.path, err)
+		}
+
+		for _, f := range batch {
+			k := idKey(f)
+			if _, ok := seen[k]; ok {
+				continue
+			}
+			seen[k] = struct{}{}
+			found = append(found, f)
+		}
+	}
+
+	return found, nil
+}
+
+// idKey makes any _id usable as a map key, documents included
+func idKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// objectIDs keeps the IDs that links can reference
+func objectIDs(vs []interface{}) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for _, v := range vs {
+		if id, ok := v.(primitive.ObjectID); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids
+}
+
+// Print writes n as a tree, every line with the number of documents of the node and of its descendants
+func Print(w io.Writer, n *Node) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s: %d documents impacted\n", n.Collection, shellValue(n.IDs[0]), n.Count()-1)
+	printChildren(&b, n, "")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func printChildren(b *strings.Builder, n *Node, indent string) {
+	for i, c := range n.Children {
+		branch, next := "├── ", "│   "
+		if i == len(n.Children)-1 {
+			branch, next = "└── ", "    "
+		}
+
+		fmt.Fprintf(b, "%s%s%s.%s: %d documents", indent, branch, c.Collection, c.Path, len(c.IDs))
+		if total := c.Count(); total != len(c.IDs) {
+			fmt.Fprintf(b, ", %d with their references", total)
+		}
+		b.WriteString("\n")
+
+		printChildren(b, c, indent+next)
+	}
+}
+
+// Mode tells what a cascade does to the documents referencing the deleted one
+type Mode string
+
+// All the modes of a cascade
+const (
+	// ModeDelete deletes the referencing documents and, recursively, what references them
+	ModeDelete Mode = "delete"
+	// ModeUnset only removes the references: scalar links are unset and array elements pulled, in every element
+	// of the arrays holding them
+	ModeUnset Mode = "unset"
+)
+
+// Validate returns an error when m isn't one of the modes
+func (m Mode) Validate() error {
+	if m != ModeDelete && m != ModeUnset {
+		return fmt.Errorf("Unknown cascade mode %q, expected %s or %s", m, ModeDelete, ModeUnset)
+	}
+
+	return nil
+}
+
+// Operations returns the mongo shell commands a cascade removing the root of n would run, the deepest documents first.
+// Nothing is run, the commands are meant to be reviewed
+func Operations(n *Node, mode Mode) ([]string, error) {
+	if err := mode.Validate(); err != nil {
+		return nil, err
+	}
+
+	ops := []string{}
+	switch mode {
+	case ModeDelete:
+		ops = deletes(n, ops, map[string]struct{}{})
+	case ModeUnset:
+		for _, c := range n.Children {
+			ops = append(ops, unset(c, n.IDs))
+		}
+	}
+
+	return append(ops, command(n.Collection, "deleteOne", primitive.D{{Key: "_id", Value: n.IDs[0]}})), nil
+}
+
+// deletes appends the deletion of the descendants of n, done lists the commands already appended
+func deletes(n *Node, ops []string, done map[string]struct{}) []string {
+	for _, c := range n.Children {
+		ops = deletes(c, ops, done)
+
+		op := command(c.Collection, "deleteMany", primitive.D{{Key: "_id", Value: primitive.D{{Key: "$in", Value: primitive.A(c.IDs)}}}})
+		if _, ok := done[op]; !ok {
+			done[op] = struct{}{}
+			ops = append(ops, op)
+		}
+	}
+
+	return ops
+}
+
+// unset removes the references of c to the parent IDs
+func unset(c *Node, parents []interface{}) string {
+	values := primitive.A{}
+	for _, id := range objectIDs(parents) {
+		values = append(values, id, id.Hex())
+	}
+	in := primitive.D{{Key: "$in", Value: values}}
+	filter := primitive.D{{Key: discover.DotPath(c.Path), Value: in}}
+
+	segments := strings.Split(c.Path, ".")
+	last := -1
+	for i, s := range segments {
+		if s == "$" {
+			last = i
+		}
+	}
+	if last < 0 {
+		return command(c.Collection, "updateMany", filter, primitive.D{{Key: "$unset", Value: primitive.D{{Key: c.Path, Value: ""}}}})
+	}
+
+	// Every element of the outer arrays is visited with $[]
+	outer := strings.Join(segments[:last], ".")
+	outer = strings.ReplaceAll(outer, "$", "$[]")
+
+	// The references held by the innermost array are pulled from it
+	if last == len(segments)-1 {
+		return command(c.Collection, "updateMany", filter, primitive.D{{Key: "$pull", Value: primitive.D{{Key: outer, Value: in}}}})
+	}
+
+	// Otherwise the field is unset in the elements of the innermost array holding a reference, the elements are kept
+	rest := strings.Join(segments[last+1:], ".")
+	return command(c.Collection, "updateMany", filter,
+		primitive.D{{Key: "$unset", Value: primitive.D{{Key: outer + ".$[ref]." + rest, Value: ""}}}},
+		primitive.D{{Key: "arrayFilters", Value: primitive.A{primitive.D{{Key: "ref." + rest, Value: in}}}}},
+	)
+}
+
+// command writes the call of method on collection with its arguments in the mongo shell syntax
+func command(collection, method string, args ...primitive.D) string {
+	db, c := collection, collection
+	if i := strings.Index(collection, "."); i >= 0 {
+		db, c = collection[:i], collection[i+1:]
+	}
+
+	values := make([]string, 0, len(args))
+	for _, a := range args {
+		values = append(values, shellValue(a))
+	}
+
+	return fmt.Sprintf("db.getSiblingDB(%q).getCollection(%q).%s(%s);", db, c, method, strings.Join(values, ", "))
+}
+
+// shellValue writes v as a mongo shell literal
+func shellValue(v interface{}) string {
+	switch t := v.(type) {
+	case primitive.ObjectID:
+		return fmt.Sprintf("ObjectId(%q)", t.Hex())
+	case string:
+		return fmt.Sprintf("%q", t)
+	case primitive.D:
+		fs := make([]string, 0, len(t))
+		for _, e := range t {
+			fs = append(fs, fmt.Sprintf("%q: %s", e.Key, shellValue(e.Value)))
+		}
+		return "{ " + strings.Join(fs, ", ") + " }"
+	case primitive.A:
+		es := make([]string, 0, len(t))
+		for _, e := range t {
+			es = append(es, shellValue(e))
+		}
+		return "[" + strings.Join(es, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", t)
+	}
+}
@@ -0,0 +1,162 @@
+package impact
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestAnalyzer_Impact(t *testing.T) {
+	ctx := context.Background()
+	user, other := primitive.NewObjectID(), primitive.NewObjectID()
+	orders := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	payment := primitive.NewObjectID()
+
+	f := inmem.New(0).
+		Insert("shop", "users", primitive.M{"_id": user}, primitive.M{"_id": other}).
+		Insert("shop", "orders",
+			primitive.M{"_id": orders[0], "userId": user},
+			primitive.M{"_id": orders[1], "userId": user.Hex()},
+			primitive.M{"_id": primitive.NewObjectID(), "userId": other},
+		).
+		Insert("shop", "payments", primitive.M{"_id": payment, "lines": primitive.A{primitive.M{"orderId": orders[1]}}}).
+		Insert("shop", "teams", primitive.M{"_id": primitive.NewObjectID(), "memberIds": primitive.A{other}})
+
+	links := map[string]discover.CollectionLinks{
+		"orders":   {"userId": {Path: "userId", With: []string{"shop.users"}}},
+		"payments": {"lines.$.orderId": {Path: "lines.$.orderId", With: []string{"shop.orders"}}},
+		"teams":    {"memberIds.$": {Path: "memberIds.$", With: []string{"shop.users"}}},
+	}
+
+	root, err := NewAnalyzer(f, "shop", links).Impact(ctx, "shop.users", user, 3)
+	if err != nil {
+		t.Fatalf("Analyzer.Impact() error = %v", err)
+	}
+
+	want := &Node{Collection: "shop.users", IDs: []interface{}{user}, Children: []*Node{
+		{Collection: "shop.orders", Path: "userId", IDs: []interface{}{orders[0], orders[1]}, Children: []*Node{
+			{Collection: "shop.payments", Path: "lines.$.orderId", IDs: []interface{}{payment}},
+		}},
+	}}
+	if !reflect.DeepEqual(root, want) {
+		t.Fatalf("Analyzer.Impact() = %+v, want %+v", root, want)
+	}
+	if root.Count() != 4 {
+		t.Errorf("Node.Count() = %d, want 4", root.Count())
+	}
+
+	var b bytes.Buffer
+	if err := Print(&b, root); err != nil || !strings.Contains(b.String(), "└── shop.orders.userId: 2 documents, 3 with their references") {
+		t.Errorf("Print() = %s, %v", b.String(), err)
+	}
+
+	ops, _ := Operations(root, ModeDelete)
+	if len(ops) != 3 || !strings.Contains(ops[0], `getCollection("payments").deleteMany`) || !strings.Contains(ops[2], "deleteOne") {
+		t.Errorf("Operations(delete) = %v", ops)
+	}
+
+	ops, _ = Operations(&Node{Collection: "shop.users", IDs: []interface{}{other}, Children: []*Node{{Collection: "shop.teams", Path: "memberIds.$", IDs: []interface{}{1}}}}, ModeUnset)
+	wantPull := `db.getSiblingDB("shop").getCollection("teams").updateMany({ "memberIds": { "$in": [ObjectId("` + other.Hex() + `"), "` + other.Hex() + `"] } }, { "$pull": { "memberIds": { "$in": [ObjectId("` + other.Hex() + `"), "` + other.Hex() + `"] } } });`
+	if len(ops) != 2 || ops[0] != wantPull {
+		t.Errorf("Operations(unset) = %v, want %s first", ops, wantPull)
+	}
+}
+
+func TestOperations_Unset(t *testing.T) {
+	id := primitive.NewObjectID()
+	in := `{ "$in": [ObjectId("` + id.Hex() + `"), "` + id.Hex() + `"] }`
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "scalar", path: "userId", want: `{ "userId": ` + in + ` }, { "$unset": { "userId": "" } }`},
+		{name: "array", path: "memberIds.$", want: `{ "memberIds": ` + in + ` }, { "$pull": { "memberIds": ` + in + ` } }`},
+		{name: "field of array elements", path: "lines.$.orderId",
+			want: `{ "lines.orderId": ` + in + ` }, { "$unset": { "lines.$[ref].orderId": "" } }, { "arrayFilters": [{ "ref.orderId": ` + in + ` }] }`},
+		{name: "nested arrays", path: "boxes.$.$",
+			want: `{ "boxes": ` + in + ` }, { "$pull": { "boxes.$[]": ` + in + ` } }`},
+		{name: "field of nested array elements", path: "boxes.$.items.$.meta.tagId",
+			want: `{ "boxes.items.meta.tagId": ` + in + ` }, { "$unset": { "boxes.$[].items.$[ref].meta.tagId": "" } }, { "arrayFilters": [{ "ref.meta.tagId": ` + in + ` }] }`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &Node{Collection: "shop.users", IDs: []interface{}{id}, Children: []*Node{{Collection: "shop.orders", Path: tt.path, IDs: []interface{}{1}}}}
+			ops, err := Operations(n, ModeUnset)
+			if err != nil {
+				t.Fatalf("Operations() error = %v", err)
+			}
+
+			want := `db.getSiblingDB("shop").getCollection("orders").updateMany(` + tt.want + `);`
+			if len(ops) != 2 || ops[0] != want {
+				t.Errorf("Operations() = %v, want %s first", ops, want)
+			}
+		})
+	}
+}
+
+// batchFinder records the number of IDs of every FindReferencing call
+type batchFinder struct {
+	*inmem.Fetcher
+	batches []int
+}
+
+func (f *batchFinder) FindReferencing(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]interface{}, error) {
+	f.batches = append(f.batches, len(ids))
+	return f.Fetcher.FindReferencing(ctx, db, collection, path, ids)
+}
+
+func TestAnalyzer_Batches(t *testing.T) {
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	orders := make([]primitive.ObjectID, 5)
+	f := &batchFinder{Fetcher: inmem.New(0).Insert("shop", "users", primitive.M{"_id": user})}
+	for i := range orders {
+		orders[i] = primitive.NewObjectID()
+		f.Insert("shop", "orders", primitive.M{"_id": orders[i], "userId": user})
+	}
+	// The payment references orders of two batches and must be listed once
+	payment := primitive.NewObjectID()
+	f.Insert("shop", "payments", primitive.M{"_id": payment, "orderIds": primitive.A{orders[0], orders[4]}})
+
+	links := map[string]discover.CollectionLinks{
+		"orders":   {"userId": {Path: "userId", With: []string{"shop.users"}}},
+		"payments": {"orderIds.$": {Path: "orderIds.$", With: []string{"shop.orders"}}},
+	}
+	root, err := NewAnalyzer(f, "shop", links, WithBatchSize(2)).Impact(ctx, "shop.users", user, 2)
+	if err != nil {
+		t.Fatalf("Analyzer.Impact() error = %v", err)
+	}
+
+	if want := []int{1, 2, 2, 1}; !reflect.DeepEqual(f.batches, want) {
+		t.Errorf("FindReferencing() batches = %v, want %v", f.batches, want)
+	}
+	payments := root.Children[0].Children
+	if len(payments) != 1 || !reflect.DeepEqual(payments[0].IDs, []interface{}{payment}) {
+		t.Errorf("Analyzer.Impact() payments = %+v, want the payment once", payments)
+	}
+}
+
+func TestMode_Validate(t *testing.T) {
+	tests := []struct {
+		mode    Mode
+		wantErr bool
+	}{
+		{mode: ModeDelete},
+		{mode: ModeUnset},
+		{mode: "delet", wantErr: true},
+		{mode: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.mode.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Mode(%q).Validate() error = %v, wantErr %v", tt.mode, err, tt.wantErr)
+		}
+	}
+}
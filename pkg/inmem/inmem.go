@@ -0,0 +1,355 @@
+package inmem
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/extjson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const primaryKey = "_id"
+
+// Fetcher is an in-memory discover.Fetcher holding databases -> collections -> documents
+type Fetcher struct {
+	mu   sync.RWMutex
+	seed int64
+	dbs  map[string]map[string]*collection
+}
+
+type collection struct {
+	docs    []primitive.M
+	ids     map[primitive.ObjectID]struct{}
+	indexes []primitive.D
+}
+
+// New creates an empty Fetcher, seed makes SampleCollection deterministic
+func New(seed int64) *Fetcher {
+	return &Fetcher{seed: seed, dbs: map[string]map[string]*collection{}}
+}
+
+// Insert appends docs to db.collection, creating both if needed, and returns f to chain calls
+func (f *Fetcher) Insert(db, collection string, docs ...primitive.M) *Fetcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.collection(db, collection)
+	for _, d := range docs {
+		c.docs = append(c.docs, d)
+		if id, ok := d[primaryKey].(primitive.ObjectID); ok {
+			c.ids[id] = struct{}{}
+		}
+	}
+
+	return f
+}
+
+// CreateIndex declares an index named name over keys on db.collection, creating both if needed,
+// and returns f to chain calls. Every collection already has the _id_ index
+func (f *Fetcher) CreateIndex(db, collection, name string, keys primitive.D) *Fetcher {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c := f.collection(db, collection)
+	c.indexes = append(c.indexes, primitive.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: keys}, {Key: "name", Value: name}})
+
+	return f
+}
+
+func idIndex() primitive.D {
+	return primitive.D{{Key: "v", Value: int32(2)}, {Key: "key", Value: primitive.D{{Key: primaryKey, Value: int32(1)}}}, {Key: "name", Value: "_id_"}}
+}
+
+// collection returns db.name, creating it if needed, f.mu must be held
+func (f *Fetcher) collection(db, name string) *collection {
+	cls, ok := f.dbs[db]
+	if !ok {
+		cls = map[string]*collection{}
+		f.dbs[db] = cls
+	}
+
+	c, ok := cls[name]
+	if !ok {
+		c = &collection{
+			ids:     map[primitive.ObjectID]struct{}{},
+			indexes: []primitive.D{idIndex()},
+		}
+		cls[name] = c
+	}
+
+	return c
+}
+
+// Load reads Extended JSON documents from r, either as an array or one document after another, into db.collection
+func (f *Fetcher) Load(db, collection string, r io.Reader) error {
+	docs, err := extjson.Decode(r)
+	if err != nil {
+		return fmt.Errorf("Error during loading %s.%s: %w", db, collection, err)
+	}
+
+	f.Insert(db, collection, docs...)
+	return nil
+}
+
+// LoadDir loads every dir/<db>/<collection>.json file
+func (f *Fetcher) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*", "*.json"))
+	if err != nil {
+		return fmt.Errorf("Error during listing fixtures of %s: %w", dir, err)
+	}
+
+	for _, file := range files {
+		db := filepath.Base(filepath.Dir(file))
+		collection := strings.TrimSuffix(filepath.Base(file), ".json")
+
+		r, err := os.Open(file)
+		if err != nil {
+			return fmt.Errorf("Error during opening fixture %s: %w", file, err)
+		}
+
+		err = f.Load(db, collection, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExistsByID tests the existence of a document by its ID in a specific database collection
+func (f *Fetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return false, nil
+	}
+
+	_, ok = c.ids[id]
+	return ok, nil
+}
+
+// ListDatabases returns all database names sorted
+func (f *Fetcher) ListDatabases(ctx context.Context) ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	dbs := make([]string, 0, len(f.dbs))
+	for db := range f.dbs {
+		dbs = append(dbs, db)
+	}
+	sort.Strings(dbs)
+
+	return dbs, nil
+}
+
+// ListCollections returns all collection names of db sorted, an unknown db has no collection
+func (f *Fetcher) ListCollections(ctx context.Context, db string) ([]string, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	cls := make([]string, 0, len(f.dbs[db]))
+	for c := range f.dbs[db] {
+		cls = append(cls, c)
+	}
+	sort.Strings(cls)
+
+	return cls, nil
+}
+
+// SampleCollection returns size documents of db.collection in a random order.
+// The order only depends on the seed, db and collection so concurrent scans stay reproducible
+func (f *Fetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return []primitive.M{}, nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(db + "." + collection))
+	rnd := rand.New(rand.NewSource(f.seed ^ int64(h.Sum64())))
+
+	docs := make([]primitive.M, len(c.docs))
+	for i, j := range rnd.Perm(len(c.docs)) {
+		docs[i] = c.docs[j]
+	}
+
+	if size < len(docs) {
+		docs = docs[:size]
+	}
+
+	return docs, nil
+}
+
+// ListIndexes returns the indexes of db.collection, an unknown collection has none
+func (f *Fetcher) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return []primitive.D{}, nil
+	}
+
+	return append([]primitive.D{}, c.indexes...), nil
+}
+
+// EstimatedCount returns the exact number of documents of db.collection
+func (f *Fetcher) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return 0, nil
+	}
+
+	return int64(len(c.docs)), nil
+}
+
+// ArrayLengths counts the arrays found at the link path of every document of db.collection by length
+func (f *Fetcher) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	lengths := map[int]int{}
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return lengths, nil
+	}
+
+	for _, d := range c.docs {
+		for _, v := range discover.ValuesAt(d, path) {
+			if a, ok := v.(primitive.A); ok {
+				lengths[len(a)]++
+			}
+		}
+	}
+
+	return lengths, nil
+}
+
+// FindReferencing returns the _id of the documents of db.collection holding one of ids at the link path
+func (f *Fetcher) FindReferencing(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]interface{}, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	found := []interface{}{}
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return found, nil
+	}
+
+	set := idSet(ids)
+	for _, d := range c.docs {
+		if references(d, path, set) {
+			found = append(found, d[primaryKey])
+		}
+	}
+
+	return found, nil
+}
+
+// Referenced returns the ids held at the link path by some document of db.collection
+func (f *Fetcher) Referenced(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	found := []primitive.ObjectID{}
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return found, nil
+	}
+
+	set := idSet(ids)
+	for _, d := range c.docs {
+		for _, v := range discover.ValuesAt(d, path) {
+			if id, ok := discover.ObjectIDOf(v); ok {
+				if _, ok := set[id]; ok {
+					delete(set, id)
+					found = append(found, id)
+				}
+			}
+		}
+	}
+
+	return found, nil
+}
+
+// FindByIDs returns the documents of db.collection whose _id is one of ids
+func (f *Fetcher) FindByIDs(ctx context.Context, db, collection string, ids []primitive.ObjectID) ([]primitive.M, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	docs := []primitive.M{}
+	c, ok := f.dbs[db][collection]
+	if !ok {
+		return docs, nil
+	}
+
+	set := idSet(ids)
+	for _, d := range c.docs {
+		if id, ok := d[primaryKey].(primitive.ObjectID); ok {
+			if _, ok := set[id]; ok {
+				docs = append(docs, d)
+			}
+		}
+	}
+
+	return docs, nil
+}
+
+// Each calls fn for every document of db.collection in insertion order, stopping at the first error
+func (f *Fetcher) Each(ctx context.Context, db, collection string, fn func(m primitive.M) error) error {
+	f.mu.RLock()
+	c, ok := f.dbs[db][collection]
+	var docs []primitive.M
+	if ok {
+		docs = append(docs, c.docs...)
+	}
+	f.mu.RUnlock()
+
+	for _, d := range docs {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func idSet(ids []primitive.ObjectID) map[primitive.ObjectID]struct{} {
+	set := make(map[primitive.ObjectID]struct{}, len(ids))
+	for _, id := range ids {
+		set[id] = struct{}{}
+	}
+
+	return set
+}
+
+// references reports whether m holds one of ids at the link path
+func references(m primitive.M, path string, ids map[primitive.ObjectID]struct{}) bool {
+	for _, v := range discover.ValuesAt(m, path) {
+		if id, ok := discover.ObjectIDOf(v); ok {
+			if _, ok := ids[id]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
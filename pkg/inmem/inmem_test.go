@@ -0,0 +1,100 @@
+package inmem
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestDiscover_Database(t *testing.T) {
+	ctx := context.Background()
+
+	aIds := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+	bIds := []primitive.ObjectID{primitive.NewObjectID(), primitive.NewObjectID()}
+
+	f := New(42).
+		Insert("db", "A", primitive.M{"_id": aIds[0], "name": "a0"}, primitive.M{"_id": aIds[1], "name": "a1"}).
+		Insert("db", "B", primitive.M{"_id": bIds[0], "aId": aIds[0]}, primitive.M{"_id": bIds[1], "aId": aIds[1].Hex()}).
+		Insert("db", "C",
+			primitive.M{"_id": primitive.NewObjectID(), "owner": primitive.M{"aId": aIds[0]}, "items": primitive.A{primitive.M{"bId": bIds[0]}}},
+			primitive.M{"_id": primitive.NewObjectID(), "items": primitive.A{primitive.M{"bId": bIds[1]}}},
+		)
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err := d.Database(ctx, "db")
+	if err != nil {
+		t.Fatalf("Discover.Database() error = %v", err)
+	}
+
+	want := map[string]discover.CollectionLinks{
+		"A": {},
+		"B": {"aId": {Path: "aId", With: []string{"db.A"}, Avg: 1}},
+		"C": {
+			"owner.aId":   {Path: "owner.aId", With: []string{"db.A"}, Avg: 0.5},
+			"items.$.bId": {Path: "items.$.bId", With: []string{"db.B"}, Avg: 1},
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover.Database() = %+v, want %+v", got, want)
+	}
+}
+
+func TestFetcher_SampleCollection(t *testing.T) {
+	ctx := context.Background()
+	f := New(7)
+	for i := 0; i < 50; i++ {
+		f.Insert("db", "cl", primitive.M{"_id": primitive.NewObjectID(), "i": i})
+	}
+
+	s1, _ := f.SampleCollection(ctx, "db", "cl", 10)
+	s2, _ := f.SampleCollection(ctx, "db", "cl", 10)
+	if len(s1) != 10 {
+		t.Fatalf("Fetcher.SampleCollection() returned %d documents, want 10", len(s1))
+	}
+	if !reflect.DeepEqual(s1, s2) {
+		t.Errorf("Fetcher.SampleCollection() is not deterministic: %v != %v", s1, s2)
+	}
+}
+
+func TestFetcher_LoadDir(t *testing.T) {
+	ctx := context.Background()
+
+	f := New(0)
+	if err := f.LoadDir("testdata"); err != nil {
+		t.Fatalf("Fetcher.LoadDir() error = %v", err)
+	}
+
+	alice, _ := primitive.ObjectIDFromHex("5f1b2c3d4e5f6a7b8c9d0e01")
+	if exists, err := f.ExistsByID(ctx, "shop", "users", alice); err != nil || !exists {
+		t.Errorf("Fetcher.ExistsByID() = %v, %v, want the user loaded from the array", exists, err)
+	}
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got, err := d.Database(ctx, "shop")
+	if err != nil {
+		t.Fatalf("Discover.Database() error = %v", err)
+	}
+
+	want := map[string]discover.CollectionLinks{
+		"users":  {},
+		"orders": {"userId": {Path: "userId", With: []string{"shop.users"}, Avg: 1}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Discover.Database() = %+v, want %+v", got, want)
+	}
+
+	if err := f.Load("shop", "broken", strings.NewReader(`{"_id": `)); err == nil {
+		t.Errorf("Fetcher.Load() error = nil, want an error for truncated Extended JSON")
+	}
+}
@@ -0,0 +1,45 @@
+package linkfile
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+)
+
+// Read loads the links of db from file, an output of inferer -output json, or discovers them with f when file is empty.
+// A scan where only some collections failed is accepted: warn gets its *discover.ScanError
+// and the links of the other collections are returned. It fails when no collection could be scanned
+func Read(ctx context.Context, f discover.Fetcher, db, file string, warn func(err error)) (map[string]discover.CollectionLinks, error) {
+	if file == "" {
+		d, err := discover.New(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+
+		links, err := d.Database(ctx, db)
+		var scanErr *discover.ScanError
+		if errors.As(err, &scanErr) && len(links) > 0 {
+			warn(scanErr)
+			return links, nil
+		}
+
+		return links, err
+	}
+
+	r, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("Error during opening links %s: %w", file, err)
+	}
+	defer r.Close()
+
+	links := map[string]discover.CollectionLinks{}
+	if err := json.NewDecoder(r).Decode(&links); err != nil {
+		return nil, fmt.Errorf("Error during reading links %s: %w", file, err)
+	}
+
+	return links, nil
+}
@@ -0,0 +1,84 @@
+package linkfile
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingFetcher fails to sample the collections of failing
+type failingFetcher struct {
+	*inmem.Fetcher
+	failing map[string]bool
+}
+
+func (f failingFetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	if f.failing[collection] {
+		return nil, errors.New("sampling failed")
+	}
+
+	return f.Fetcher.SampleCollection(ctx, db, collection, size)
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	src := inmem.New(0).
+		Insert("shop", "users", primitive.M{"_id": user}).
+		Insert("shop", "orders", primitive.M{"_id": primitive.NewObjectID(), "userId": user})
+	orders := discover.CollectionLinks{"userId": {Path: "userId", Avg: 1, With: []string{"shop.users"}}}
+
+	dir, err := ioutil.TempDir("", "linkfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	valid := filepath.Join(dir, "links.json")
+	if err := ioutil.WriteFile(valid, []byte(`{"orders":{"userId":{"Path":"userId","Avg":1,"With":["shop.users"]}}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := ioutil.WriteFile(invalid, []byte(`[`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		file     string
+		failing  map[string]bool
+		want     map[string]discover.CollectionLinks
+		wantWarn bool
+		wantErr  bool
+	}{
+		{name: "file", file: valid, want: map[string]discover.CollectionLinks{"orders": orders}},
+		{name: "missing file", file: filepath.Join(dir, "missing.json"), wantErr: true},
+		{name: "invalid file", file: invalid, wantErr: true},
+		{name: "discovery", want: map[string]discover.CollectionLinks{"orders": orders, "users": {}}},
+		{name: "partial discovery", failing: map[string]bool{"users": true}, want: map[string]discover.CollectionLinks{"orders": orders}, wantWarn: true},
+		{name: "failed discovery", failing: map[string]bool{"users": true, "orders": true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var warned error
+			got, err := Read(ctx, failingFetcher{Fetcher: src, failing: tt.failing}, "shop", tt.file, func(err error) { warned = err })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Read() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var scanErr *discover.ScanError
+			if errors.As(warned, &scanErr) != tt.wantWarn {
+				t.Errorf("Read() warned %v, wantWarn %v", warned, tt.wantWarn)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
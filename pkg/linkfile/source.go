@@ -0,0 +1,53 @@
+package linkfile
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/flowHater/mongo-inferer/pkg/denorm"
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/extjson"
+	"github.com/flowHater/mongo-inferer/pkg/impact"
+	"github.com/flowHater/mongo-inferer/pkg/mongoflags"
+	"github.com/flowHater/mongo-inferer/pkg/orphan"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Source is what the commands reading links work on: it discovers the links when there's no file,
+// then answers the lookups of orphan, impact and denorm
+type Source interface {
+	discover.Fetcher
+	orphan.Source
+	impact.Finder
+	denorm.Source
+}
+
+// Open returns the mongoexport files laid out as <dir>/<db>/<collection>.json when dir isn't empty,
+// a discover.Repository connected with the read and conn flags otherwise
+func Open(ctx context.Context, dir string, read *mongoflags.Read, conn *mongoflags.Client) (Source, error) {
+	if dir != "" {
+		return extjson.NewFetcher(dir, 0), nil
+	}
+
+	readOpts, err := read.RepositoryOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	clientOpts, err := conn.Options()
+	if err != nil {
+		return nil, err
+	}
+	client, err := mongo.Connect(ctx, clientOpts)
+	if err != nil {
+		return nil, fmt.Errorf("Error during connecting to MongoDB: %w", err)
+	}
+
+	return discover.NewRepository(append(readOpts, discover.RepositoryWithClient(client))...), nil
+}
+
+// WarnPartial logs the collections a scan could not read, it's the warn func of Read for commands going on without them
+func WarnPartial(err error) {
+	log.Printf("Warning: %s, going on with the links of the other collections", err)
+}
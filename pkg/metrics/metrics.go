@@ -0,0 +1,187 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const namespace = "mongo_inferer"
+
+// Metrics holds all the collectors about a scan.
+// It's a discover.Observer and it can decorate a discover.Fetcher
+type Metrics struct {
+	calls     *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	latency   *prometheus.HistogramVec
+	cache     *prometheus.CounterVec
+	sampled   prometheus.Counter
+	links     prometheus.Counter
+	unknown   prometheus.Counter
+	scanned   prometheus.Counter
+	scanError prometheus.Counter
+}
+
+// New creates all collectors and registers them on reg
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		calls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "fetcher", Name: "calls_total",
+			Help: "Number of calls to the Fetcher by method.",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Subsystem: "fetcher", Name: "errors_total",
+			Help: "Number of calls to the Fetcher that returned an error by method.",
+		}, []string{"method"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace, Subsystem: "fetcher", Name: "duration_seconds",
+			Help:    "Latency of the calls to the Fetcher by method.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"method"}),
+		cache: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace, Name: "cache_lookups_total",
+			Help: "Number of ID existence lookups by result, hit when answered by the cache and miss when the Fetcher was asked.",
+		}, []string{"result"}),
+		sampled: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "documents_sampled_total",
+			Help: "Number of documents sampled from all collections.",
+		}),
+		links: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "links_discovered_total",
+			Help: "Number of link paths discovered in all collections.",
+		}),
+		unknown: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "unknown_oids_total",
+			Help: "Number of ObjectIds that did not match any collection.",
+		}),
+		scanned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "collections_scanned_total",
+			Help: "Number of collections scanned.",
+		}),
+		scanError: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace, Name: "scan_errors_total",
+			Help: "Number of errors reported during scans.",
+		}),
+	}
+
+	for _, c := range []prometheus.Collector{m.calls, m.errors, m.latency, m.cache, m.sampled, m.links, m.unknown, m.scanned, m.scanError} {
+		if err := reg.Register(c); err != nil {
+			return nil, fmt.Errorf("Error during registering metrics: %w", err)
+		}
+	}
+
+	return m, nil
+}
+
+// Notify implements discover.Observer
+func (m *Metrics) Notify(e discover.Event) {
+	switch e.Type {
+	case discover.EventCacheHit:
+		m.cache.WithLabelValues("hit").Inc()
+	case discover.EventIDProbed:
+		m.cache.WithLabelValues("miss").Inc()
+	case discover.EventSamplesFetched:
+		m.sampled.Add(float64(e.Count))
+	case discover.EventCollectionFinished:
+		m.scanned.Inc()
+		m.links.Add(float64(e.Count))
+	case discover.EventUnknownOID:
+		m.unknown.Inc()
+	case discover.EventError:
+		m.scanError.Inc()
+	}
+}
+
+// Fetcher decorates f so every call is counted and timed
+func (m *Metrics) Fetcher(f discover.Fetcher) discover.Fetcher {
+	return fetcher{next: f, m: m}
+}
+
+// observe records a call of method that started at start and returned err
+func (m *Metrics) observe(method string, start time.Time, err error) {
+	m.calls.WithLabelValues(method).Inc()
+	m.latency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		m.errors.WithLabelValues(method).Inc()
+	}
+}
+
+type fetcher struct {
+	next discover.Fetcher
+	m    *Metrics
+}
+
+func (f fetcher) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	start := time.Now()
+	exists, err := f.next.ExistsByID(ctx, db, collection, id)
+	f.m.observe("ExistsByID", start, err)
+
+	return exists, err
+}
+
+func (f fetcher) ListDatabases(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	dbs, err := f.next.ListDatabases(ctx)
+	f.m.observe("ListDatabases", start, err)
+
+	return dbs, err
+}
+
+func (f fetcher) ListCollections(ctx context.Context, db string) ([]string, error) {
+	start := time.Now()
+	cls, err := f.next.ListCollections(ctx, db)
+	f.m.observe("ListCollections", start, err)
+
+	return cls, err
+}
+
+func (f fetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	start := time.Now()
+	ms, err := f.next.SampleCollection(ctx, db, collection, size)
+	f.m.observe("SampleCollection", start, err)
+
+	return ms, err
+}
+
+func (f fetcher) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	l, ok := f.next.(discover.IndexLister)
+	if !ok {
+		return nil, fmt.Errorf("ListIndexes: %w", discover.ErrUnsupported)
+	}
+
+	start := time.Now()
+	indexes, err := l.ListIndexes(ctx, db, collection)
+	f.m.observe("ListIndexes", start, err)
+
+	return indexes, err
+}
+
+func (f fetcher) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	l, ok := f.next.(discover.IndexLister)
+	if !ok {
+		return 0, fmt.Errorf("EstimatedCount: %w", discover.ErrUnsupported)
+	}
+
+	start := time.Now()
+	n, err := l.EstimatedCount(ctx, db, collection)
+	f.m.observe("EstimatedCount", start, err)
+
+	return n, err
+}
+
+func (f fetcher) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	c, ok := f.next.(discover.ArrayCounter)
+	if !ok {
+		return nil, fmt.Errorf("ArrayLengths: %w", discover.ErrUnsupported)
+	}
+
+	start := time.Now()
+	lengths, err := c.ArrayLengths(ctx, db, collection, path)
+	f.m.observe("ArrayLengths", start, err)
+
+	return lengths, err
+}
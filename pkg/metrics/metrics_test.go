@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingFetcher fails to sample the collections of the database missing
+type failingFetcher struct {
+	*inmem.Fetcher
+}
+
+func (f failingFetcher) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	if db == "missing" {
+		return nil, errors.New("no such database")
+	}
+
+	return f.Fetcher.SampleCollection(ctx, db, collection, size)
+}
+
+func TestMetrics_Fetcher(t *testing.T) {
+	ctx := context.Background()
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	f := m.Fetcher(failingFetcher{inmem.New(0).Insert("db", "A", primitive.M{"_id": primitive.NewObjectID()})})
+
+	if _, err := f.ListCollections(ctx, "db"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := f.SampleCollection(ctx, "db", "A", 10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := f.SampleCollection(ctx, "missing", "A", 10); err == nil {
+		t.Fatal("SampleCollection() error = nil, want the error of the decorated Fetcher")
+	}
+
+	m.Notify(discover.Event{Type: discover.EventSamplesFetched, Count: 3})
+	m.Notify(discover.Event{Type: discover.EventCacheHit})
+	m.Notify(discover.Event{Type: discover.EventCollectionFinished, Count: 2})
+
+	tests := []struct {
+		name string
+		c    prometheus.Collector
+		want float64
+	}{
+		{name: "ListCollections calls", c: m.calls.WithLabelValues("ListCollections"), want: 1},
+		{name: "SampleCollection calls", c: m.calls.WithLabelValues("SampleCollection"), want: 3},
+		{name: "SampleCollection errors", c: m.errors.WithLabelValues("SampleCollection"), want: 1},
+		{name: "documents sampled", c: m.sampled, want: 3},
+		{name: "cache hits", c: m.cache.WithLabelValues("hit"), want: 1},
+		{name: "collections scanned", c: m.scanned, want: 1},
+		{name: "links discovered", c: m.links, want: 2},
+	}
+	for _, tt := range tests {
+		if got := testutil.ToFloat64(tt.c); got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+	if n := testutil.CollectAndCount(m.latency); n != 2 {
+		t.Errorf("latency has %d series, want 2", n)
+	}
+}
+
+func TestNew_Registerer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	if _, err := New(reg); err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := New(reg); err == nil {
+		t.Errorf("New() twice on the same registry error = nil, want a duplicate registration error")
+	}
+	if _, err := New(prometheus.NewRegistry()); err != nil {
+		t.Errorf("New() on another registry error = %v", err)
+	}
+}
+
+func TestMetrics_FetcherUnsupported(t *testing.T) {
+	m, err := New(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// Only the methods of discover.Fetcher are promoted, so the decorated Fetcher can't list indexes nor scan arrays
+	f := m.Fetcher(struct{ discover.Fetcher }{inmem.New(0)}).(fetcher)
+
+	if _, err := f.ListIndexes(context.Background(), "db", "A"); !errors.Is(err, discover.ErrUnsupported) {
+		t.Errorf("ListIndexes() error = %v, want %v", err, discover.ErrUnsupported)
+	}
+	if _, err := f.EstimatedCount(context.Background(), "db", "A"); !errors.Is(err, discover.ErrUnsupported) {
+		t.Errorf("EstimatedCount() error = %v, want %v", err, discover.ErrUnsupported)
+	}
+	if _, err := f.ArrayLengths(context.Background(), "db", "A", "bIds"); !errors.Is(err, discover.ErrUnsupported) {
+		t.Errorf("ArrayLengths() error = %v, want %v", err, discover.ErrUnsupported)
+	}
+	if n := testutil.CollectAndCount(m.calls); n != 0 {
+		t.Errorf("calls has %d series, want none for unsupported methods", n)
+	}
+}
@@ -0,0 +1,217 @@
+package modeling
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+// defaultMaxLength is the array length from which an array is deemed unbounded
+const defaultMaxLength = 100
+
+// All the kinds of sub-documents and arrays
+const (
+	// KindEmbedded is an entity of its own, it has an ObjectId identifier that references nothing.
+	// Its other fields may still reference documents
+	KindEmbedded = "embedded"
+	// KindReference holds a link to another document, or is an array of links
+	KindReference = "reference"
+	// KindValue is a value object, it has no identity
+	KindValue = "value"
+)
+
+// idFields are the names of the fields identifying an embedded entity
+var idFields = []string{"_id", "id"}
+
+// Pattern is the kind of a sub-document, or of the elements of an array
+type Pattern struct {
+	// Path is the link path of the sub-document or of the array
+	Path  string `json:"path"`
+	Kind  string `json:"kind"`
+	Array bool   `json:"array"`
+	// IDField is the field of the sub-document identifying the entity or holding the reference
+	IDField string   `json:"idField,omitempty"`
+	With    []string `json:"with,omitempty"`
+	// References are the fields of an embedded entity referencing other documents
+	References []Reference `json:"references,omitempty"`
+	// Lengths summarises the sampled lengths of an array, Unbounded tells one of them reached the maximum length
+	Lengths   *schema.Distribution `json:"lengths,omitempty"`
+	Unbounded bool                 `json:"unbounded,omitempty"`
+}
+
+// Reference is a field of an embedded entity holding a link
+type Reference struct {
+	Field string   `json:"field"`
+	With  []string `json:"with"`
+}
+
+// Collection is the review of the sub-documents and arrays of a collection
+type Collection struct {
+	Name string `json:"name"`
+	// Count is the number of sampled documents
+	Count    int       `json:"count"`
+	Patterns []Pattern `json:"patterns"`
+}
+
+// OptionF describes a func that will be called from the Review func
+type OptionF func(*reviewer)
+
+// WithMaxLength sets the array length from which an array is deemed unbounded, 100 by default
+func WithMaxLength(n int) OptionF {
+	return func(r *reviewer) {
+		r.maxLength = n
+	}
+}
+
+type reviewer struct {
+	maxLength int
+	links     discover.CollectionLinks
+}
+
+// Review classifies the sub-documents and arrays of every collection of schemas, links tell which fields are references.
+// Collections are sorted by name and patterns by path
+func Review(schemas map[string]*schema.Document, links map[string]discover.CollectionLinks, opts ...OptionF) []Collection {
+	r := reviewer{maxLength: defaultMaxLength}
+	for _, o := range opts {
+		o(&r)
+	}
+
+	names := make([]string, 0, len(schemas))
+	for n := range schemas {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	cs := make([]Collection, 0, len(names))
+	for _, n := range names {
+		r.links = links[n]
+		cs = append(cs, Collection{Name: n, Count: schemas[n].Count, Patterns: r.document(schemas[n], "", []Pattern{})})
+	}
+
+	return cs
+}
+
+// document appends the patterns found in doc, found at the link path path
+func (r reviewer) document(doc *schema.Document, path string, ps []Pattern) []Pattern {
+	for _, n := range doc.Names() {
+		p := n
+		if path != "" {
+			p = path + "." + n
+		}
+
+		f := doc.Fields[n]
+		switch {
+		case f.Doc != nil:
+			ps = append(ps, r.classify(f.Doc, p, p))
+			ps = r.document(f.Doc, p, ps)
+		case f.Items != nil:
+			ps = append(ps, r.array(f, p))
+			if f.Items.Doc != nil {
+				ps = r.document(f.Items.Doc, p+".$", ps)
+			}
+		}
+	}
+
+	return ps
+}
+
+// array classifies the elements of the arrays of f, found at path
+func (r reviewer) array(f *schema.Field, path string) Pattern {
+	elements := path + ".$"
+
+	var pt Pattern
+	switch l, ok := r.links[elements]; {
+	case f.Items.Doc != nil:
+		pt = r.classify(f.Items.Doc, path, elements)
+	case ok:
+		pt = Pattern{Path: path, Kind: KindReference, With: l.With}
+	default:
+		pt = Pattern{Path: path, Kind: KindValue}
+	}
+
+	d := f.LengthDistribution()
+	pt.Array = true
+	pt.Lengths = &d
+	pt.Unbounded = d.Max >= r.maxLength
+
+	return pt
+}
+
+// classify tells the kind of doc, a sub-document found at the link path prefix and reported at path.
+// An identifier holding a link makes a copy of the referenced document, one matching nothing an embedded entity,
+// whatever its other fields reference
+func (r reviewer) classify(doc *schema.Document, path, prefix string) Pattern {
+	for _, n := range idFields {
+		f, ok := doc.Fields[n]
+		if !ok {
+			continue
+		}
+		if l, ok := r.links[prefix+"."+n]; ok {
+			return Pattern{Path: path, Kind: KindReference, IDField: n, With: l.With}
+		}
+		if f.Dominant() == schema.TypeObjectID {
+			return Pattern{Path: path, Kind: KindEmbedded, IDField: n, References: r.references(doc, prefix)}
+		}
+	}
+
+	for _, n := range doc.Names() {
+		if l, ok := r.links[prefix+"."+n]; ok {
+			return Pattern{Path: path, Kind: KindReference, IDField: n, With: l.With}
+		}
+	}
+
+	return Pattern{Path: path, Kind: KindValue}
+}
+
+// references lists the fields of doc, found at the link path prefix, holding a link
+func (r reviewer) references(doc *schema.Document, prefix string) []Reference {
+	var refs []Reference
+	for _, n := range doc.Names() {
+		if l, ok := r.links[prefix+"."+n]; ok {
+			refs = append(refs, Reference{Field: n, With: l.With})
+		}
+	}
+
+	return refs
+}
+
+// Write prints cs as a table per collection, followed by the arrays that should get a collection of their own
+func Write(w io.Writer, cs []Collection) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range cs {
+		fmt.Fprintf(tw, "%s: %d sampled documents\n", c.Name, c.Count)
+		if len(c.Patterns) == 0 {
+			fmt.Fprintln(tw, "  no sub-document nor array")
+		}
+
+		for _, p := range c.Patterns {
+			details := []string{}
+			if p.IDField != "" {
+				details = append(details, "by "+p.IDField)
+			}
+			if len(p.With) > 0 {
+				details = append(details, "-> "+strings.Join(p.With, " or "))
+			}
+			for _, ref := range p.References {
+				details = append(details, ref.Field+" -> "+strings.Join(ref.With, " or "))
+			}
+			if p.Lengths != nil {
+				l := p.Lengths
+				details = append(details, fmt.Sprintf("array of %d..%d, median %d, p99 %d", l.Min, l.Max, l.Median, l.P99))
+			}
+			if p.Unbounded {
+				details = append(details, "UNBOUNDED: consider a collection of its own")
+			}
+
+			fmt.Fprintf(tw, "  %s\t%s\t%s\n", p.Path, p.Kind, strings.Join(details, ", "))
+		}
+		fmt.Fprintln(tw)
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,79 @@
+package modeling
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReview(t *testing.T) {
+	ctx := context.Background()
+	user, product := primitive.NewObjectID(), primitive.NewObjectID()
+	f := inmem.New(0).
+		Insert("shop", "users", primitive.M{"_id": user}).
+		Insert("shop", "products", primitive.M{"_id": product}).
+		Insert("shop", "orders",
+			primitive.M{
+				"_id":       primitive.NewObjectID(),
+				"customer":  primitive.M{"_id": user, "name": "Alice"},
+				"lines":     primitive.A{primitive.M{"_id": primitive.NewObjectID(), "productId": product, "qty": int32(1)}},
+				"shipping":  primitive.M{"city": "Paris"},
+				"tags":      primitive.A{"a", "b", "c", "d", "e"},
+				"watcherId": primitive.A{user},
+			},
+			primitive.M{
+				"_id":      primitive.NewObjectID(),
+				"customer": primitive.M{"_id": user, "name": "Alice"},
+				"lines": primitive.A{
+					primitive.M{"_id": primitive.NewObjectID(), "productId": product, "qty": int32(2)},
+					primitive.M{"_id": primitive.NewObjectID(), "productId": product, "qty": int32(3)},
+				},
+				"tags": primitive.A{},
+			},
+		)
+
+	// The links and schemas come from a scan, as inferer builds them
+	collector := schema.NewCollector()
+	d, err := discover.New(ctx, f, discover.WithSampleObserver(collector))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "shop")
+	if err != nil {
+		t.Fatalf("Database() error = %v", err)
+	}
+	schemas := collector.Database("shop")
+	delete(schemas, "products")
+
+	got := Review(schemas, links, WithMaxLength(5))
+	want := []Collection{
+		{Name: "orders", Count: 2, Patterns: []Pattern{
+			{Path: "customer", Kind: KindReference, IDField: "_id", With: []string{"shop.users"}},
+			{Path: "lines", Kind: KindEmbedded, Array: true, IDField: "_id", References: []Reference{{Field: "productId", With: []string{"shop.products"}}}, Lengths: &schema.Distribution{Count: 2, Min: 1, Median: 1, P99: 2, Max: 2, Mean: 1.5}},
+			{Path: "shipping", Kind: KindValue},
+			{Path: "tags", Kind: KindValue, Array: true, Lengths: &schema.Distribution{Count: 2, Min: 0, Median: 0, P99: 5, Max: 5, Mean: 2.5}, Unbounded: true},
+			{Path: "watcherId", Kind: KindReference, Array: true, With: []string{"shop.users"}, Lengths: &schema.Distribution{Count: 1, Min: 1, Median: 1, P99: 1, Max: 1, Mean: 1}},
+		}},
+		{Name: "users", Count: 1, Patterns: []Pattern{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Review() = %+v, want %+v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, got); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for _, s := range []string{"orders: 2 sampled documents", "-> shop.users", "productId -> shop.products", "UNBOUNDED", "no sub-document nor array"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Write() = %s, want %s", b.String(), s)
+		}
+	}
+}
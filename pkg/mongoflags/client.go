@@ -0,0 +1,217 @@
+package mongoflags
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v2"
+)
+
+// Environment variables read when the matching flag is empty, the password is never a flag
+const (
+	EnvURI      = "MONGODB_URI"
+	EnvUsername = "MONGODB_USERNAME"
+	EnvPassword = "MONGODB_PASSWORD"
+)
+
+const (
+	defaultURI    = "mongodb://localhost:27017"
+	mechanismX509 = "MONGODB-X509"
+)
+
+// Credentials are the content of a -credentials file, in YAML or JSON
+type Credentials struct {
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password"`
+	AuthSource    string `yaml:"authSource"`
+	AuthMechanism string `yaml:"authMechanism"`
+}
+
+// LoadCredentials reads credentials in YAML or JSON from r
+func LoadCredentials(r io.Reader) (Credentials, error) {
+	c := Credentials{}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return c, fmt.Errorf("Error during reading credentials: %w", err)
+	}
+
+	// JSON is valid YAML
+	if err := yaml.UnmarshalStrict(b, &c); err != nil {
+		return c, fmt.Errorf("Error during parsing credentials: %w", err)
+	}
+
+	return c, nil
+}
+
+// Client holds the flags of the connection to MongoDB
+type Client struct {
+	uri             string
+	username        string
+	authSource      string
+	authMechanism   string
+	credentialsFile string
+	tls             bool
+	caFile          string
+	certificateFile string
+	tlsInsecure     bool
+
+	getenv func(string) string
+	prompt func(string) (string, error)
+}
+
+// RegisterClient declares the connection flags on fs
+func RegisterClient(fs *flag.FlagSet) *Client {
+	c := &Client{getenv: os.Getenv, prompt: promptPassword}
+	fs.StringVar(&c.uri, "uri", "", "connection string of MongoDB, $"+EnvURI+" or "+defaultURI+" when empty")
+	fs.StringVar(&c.username, "username", "", "user to authenticate as, $"+EnvUsername+" when empty. The password is read from $"+EnvPassword+", the -credentials file or prompted")
+	fs.StringVar(&c.authSource, "auth-source", "", "database holding the user, admin by default")
+	fs.StringVar(&c.authMechanism, "auth-mechanism", "", "SCRAM-SHA-1, SCRAM-SHA-256, MONGODB-X509, PLAIN or GSSAPI, negotiated with the server when empty")
+	fs.StringVar(&c.credentialsFile, "credentials", "", "YAML or JSON file holding username, password, authSource and authMechanism, the flags and environment take precedence")
+	fs.BoolVar(&c.tls, "tls", false, "connect with TLS, implied by the other -tls flags")
+	fs.StringVar(&c.caFile, "tls-ca-file", "", "PEM file of the certificate authorities trusted instead of the system ones")
+	fs.StringVar(&c.certificateFile, "tls-certificate-key-file", "", "PEM file holding the client certificate and its key, the X.509 identity of MONGODB-X509")
+	fs.BoolVar(&c.tlsInsecure, "tls-insecure", false, "accept any certificate and host name of the server, for tests only")
+
+	return c
+}
+
+// Options converts the flags, the environment and the credentials file to the options of a mongo.Client.
+// The password is prompted on the terminal when a user is given without one
+func (c *Client) Options() (*options.ClientOptions, error) {
+	creds := Credentials{}
+	if c.credentialsFile != "" {
+		f, err := os.Open(c.credentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error during opening credentials %s: %w", c.credentialsFile, err)
+		}
+		creds, err = LoadCredentials(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	uri := first(c.uri, c.getenv(EnvURI), defaultURI)
+	opts := options.Client().ApplyURI(uri)
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("Invalid connection string: %w", err)
+	}
+
+	auth := options.Credential{}
+	if opts.Auth != nil {
+		auth = *opts.Auth
+	}
+	uriUsername := auth.Username
+	auth.Username = first(c.username, c.getenv(EnvUsername), creds.Username, auth.Username)
+	if auth.Username != uriUsername {
+		// The password of the URI belongs to its user, never send it for another one
+		auth.Password, auth.PasswordSet = "", false
+	}
+	auth.AuthSource = first(c.authSource, creds.AuthSource, auth.AuthSource)
+	auth.AuthMechanism = first(c.authMechanism, creds.AuthMechanism, auth.AuthMechanism)
+	credsPassword := creds.Password
+	if creds.Username != "" && creds.Username != auth.Username {
+		// The password of the credentials file belongs to its user too
+		credsPassword = ""
+	}
+	if p := first(c.getenv(EnvPassword), credsPassword); p != "" {
+		auth.Password, auth.PasswordSet = p, true
+	}
+
+	if auth.Username != "" && !auth.PasswordSet && auth.AuthMechanism != mechanismX509 && auth.AuthMechanism != "GSSAPI" {
+		p, err := c.prompt(fmt.Sprintf("Password of %s: ", auth.Username))
+		if err != nil {
+			return nil, err
+		}
+		auth.Password, auth.PasswordSet = p, true
+	}
+	if auth.Username != "" || auth.AuthMechanism != "" {
+		opts.SetAuth(auth)
+	}
+
+	if c.tls || c.caFile != "" || c.certificateFile != "" || c.tlsInsecure {
+		cfg, err := c.tlsConfig(opts.TLSConfig)
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(cfg)
+	}
+
+	if auth.AuthMechanism == mechanismX509 && (opts.TLSConfig == nil || len(opts.TLSConfig.Certificates) == 0) {
+		return nil, fmt.Errorf("%s needs a client certificate, set -tls-certificate-key-file", mechanismX509)
+	}
+
+	return opts, nil
+}
+
+// tlsConfig adds the TLS flags to cfg, the configuration of the connection string
+func (c *Client) tlsConfig(cfg *tls.Config) (*tls.Config, error) {
+	if cfg == nil {
+		cfg = &tls.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+
+	if c.caFile != "" {
+		b, err := ioutil.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error during reading CA file %s: %w", c.caFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("No PEM certificate found in CA file %s", c.caFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if c.certificateFile != "" {
+		// The certificate and its key are in the same file, like mongosh expects
+		cert, err := tls.LoadX509KeyPair(c.certificateFile, c.certificateFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error during loading client certificate %s: %w", c.certificateFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if c.tlsInsecure {
+		cfg.InsecureSkipVerify = true
+	}
+
+	return cfg, nil
+}
+
+// promptPassword reads a password on the terminal without echoing it
+func promptPassword(prompt string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("No password given and stdin is not a terminal to prompt it, set $%s or -credentials", EnvPassword)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	p, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("Error during reading password: %w", err)
+	}
+
+	return string(p), nil
+}
+
+// first returns the first non empty of ss
+func first(ss ...string) string {
+	for _, s := range ss {
+		if s != "" {
+			return s
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,100 @@
+package mongoflags
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestClient_Options(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mongoflags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	credentials := filepath.Join(dir, "credentials.yml")
+	if err := ioutil.WriteFile(credentials, []byte("username: file\npassword: secret\nauthSource: admin\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	passwordOnly := filepath.Join(dir, "password.yml")
+	if err := ioutil.WriteFile(passwordOnly, []byte("password: secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	notPEM := filepath.Join(dir, "ca.pem")
+	if err := ioutil.WriteFile(notPEM, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		c        Client
+		env      map[string]string
+		wantHost string
+		wantAuth *options.Credential
+		wantErr  bool
+	}{
+		{name: "default", wantHost: "localhost:27017"},
+		{name: "uri from env", env: map[string]string{EnvURI: "mongodb://db:27018"}, wantHost: "db:27018"},
+		{name: "password from env", c: Client{username: "alice"}, env: map[string]string{EnvPassword: "env"}, wantHost: "localhost:27017",
+			wantAuth: &options.Credential{Username: "alice", Password: "env", PasswordSet: true}},
+		{name: "password prompted", c: Client{uri: "mongodb://bob@db", authSource: "users"}, wantHost: "db",
+			wantAuth: &options.Credential{Username: "bob", AuthSource: "users", Password: "prompted", PasswordSet: true}},
+		{name: "password of the URI user", c: Client{uri: "mongodb://bob:uri@db"}, wantHost: "db",
+			wantAuth: &options.Credential{Username: "bob", AuthSource: "admin", Password: "uri", PasswordSet: true}},
+		{name: "username overridden by flag", c: Client{uri: "mongodb://bob:uri@db", username: "alice"}, wantHost: "db",
+			wantAuth: &options.Credential{Username: "alice", AuthSource: "admin", Password: "prompted", PasswordSet: true}},
+		{name: "username overridden by env", c: Client{uri: "mongodb://bob:uri@db"}, env: map[string]string{EnvUsername: "carol", EnvPassword: "env"}, wantHost: "db",
+			wantAuth: &options.Credential{Username: "carol", AuthSource: "admin", Password: "env", PasswordSet: true}},
+		{name: "username overridden by file", c: Client{uri: "mongodb://bob:uri@db", credentialsFile: credentials}, wantHost: "db",
+			wantAuth: &options.Credential{Username: "file", AuthSource: "admin", Password: "secret", PasswordSet: true}},
+		{name: "credentials file", c: Client{credentialsFile: credentials}, wantHost: "localhost:27017",
+			wantAuth: &options.Credential{Username: "file", AuthSource: "admin", Password: "secret", PasswordSet: true}},
+		{name: "credentials file of another user", c: Client{credentialsFile: credentials, username: "flag"}, wantHost: "localhost:27017",
+			wantAuth: &options.Credential{Username: "flag", AuthSource: "admin", Password: "prompted", PasswordSet: true}},
+		{name: "credentials file of another user from env", c: Client{credentialsFile: credentials}, env: map[string]string{EnvUsername: "carol"}, wantHost: "localhost:27017",
+			wantAuth: &options.Credential{Username: "carol", AuthSource: "admin", Password: "prompted", PasswordSet: true}},
+		{name: "credentials file without user", c: Client{credentialsFile: passwordOnly, username: "flag"}, wantHost: "localhost:27017",
+			wantAuth: &options.Credential{Username: "flag", Password: "secret", PasswordSet: true}},
+		{name: "x509 without certificate", c: Client{authMechanism: mechanismX509}, wantErr: true},
+		{name: "invalid CA file", c: Client{caFile: notPEM}, wantErr: true},
+		{name: "missing credentials file", c: Client{credentialsFile: filepath.Join(dir, "missing")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.c
+			c.getenv = func(k string) string { return tt.env[k] }
+			c.prompt = func(string) (string, error) { return "prompted", nil }
+
+			got, err := c.Options()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Options() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Hosts, []string{tt.wantHost}) {
+				t.Errorf("Options().Hosts = %v, want %s", got.Hosts, tt.wantHost)
+			}
+			if !reflect.DeepEqual(got.Auth, tt.wantAuth) {
+				t.Errorf("Options().Auth = %+v, want %+v", got.Auth, tt.wantAuth)
+			}
+		})
+	}
+}
+
+func TestClient_OptionsTLSInsecure(t *testing.T) {
+	c := Client{tlsInsecure: true, getenv: func(string) string { return "" }}
+	got, err := c.Options()
+	if err != nil {
+		t.Fatalf("Options() error = %v", err)
+	}
+	if got.TLSConfig == nil || !got.TLSConfig.InsecureSkipVerify {
+		t.Errorf("Options().TLSConfig = %+v, want InsecureSkipVerify", got.TLSConfig)
+	}
+}
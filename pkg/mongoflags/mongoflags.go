@@ -0,0 +1,118 @@
+package mongoflags
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+// Read holds the flags shaping the reads of a discover.Repository
+type Read struct {
+	preference string
+	tags       string
+	concern    string
+	maxTime    time.Duration
+}
+
+// RegisterRead declares the read flags on fs
+func RegisterRead(fs *flag.FlagSet) *Read {
+	r := &Read{}
+	fs.StringVar(&r.preference, "read-preference", "", "members to read from: primary, primaryPreferred, secondary, secondaryPreferred or nearest. The one of the URI when empty")
+	fs.StringVar(&r.tags, "read-preference-tags", "", "tag sets selecting the members, e.g. dc:east,use:reporting;dc:west tries east first")
+	fs.StringVar(&r.concern, "read-concern", "", "read concern level: local, available, majority, linearizable or snapshot. The one of the URI when empty")
+	fs.DurationVar(&r.maxTime, "max-time", 0, "maxTimeMS of every query, the server aborts the slower ones. 0 lets them run")
+
+	return r
+}
+
+// RepositoryOptions converts the flags to the options of a discover.Repository
+func (r *Read) RepositoryOptions() ([]discover.RepositoryOptionF, error) {
+	opts := []discover.RepositoryOptionF{discover.RepositoryWithMaxTime(r.maxTime)}
+
+	rp, err := ReadPreference(r.preference, r.tags)
+	if err != nil {
+		return nil, err
+	}
+	if rp != nil {
+		opts = append(opts, discover.RepositoryWithReadPreference(rp))
+	}
+
+	if r.concern != "" {
+		rc, err := ReadConcern(r.concern)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, discover.RepositoryWithReadConcern(rc))
+	}
+
+	return opts, nil
+}
+
+// ReadPreference parses a read preference mode and its tag sets, sets are separated by ; and tags by ,.
+// It's nil when both are empty
+func ReadPreference(mode, tags string) (*readpref.ReadPref, error) {
+	if mode == "" {
+		if tags != "" {
+			return nil, fmt.Errorf("Invalid read preference: tags without a mode")
+		}
+		return nil, nil
+	}
+
+	m, err := readpref.ModeFromString(mode)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid read preference %q: %w", mode, err)
+	}
+
+	sets := []tag.Set{}
+	for _, s := range strings.Split(tags, ";") {
+		if s == "" {
+			continue
+		}
+
+		set := tag.Set{}
+		for _, t := range strings.Split(s, ",") {
+			kv := strings.SplitN(t, ":", 2)
+			if len(kv) != 2 || kv[0] == "" {
+				return nil, fmt.Errorf("Invalid read preference tag %q, expected name:value", t)
+			}
+			set = append(set, tag.Tag{Name: kv[0], Value: kv[1]})
+		}
+		sets = append(sets, set)
+	}
+
+	opts := []readpref.Option{}
+	if len(sets) > 0 {
+		opts = append(opts, readpref.WithTagSets(sets...))
+	}
+
+	rp, err := readpref.New(m, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid read preference %q: %w", mode, err)
+	}
+
+	return rp, nil
+}
+
+// ReadConcern parses a read concern level
+func ReadConcern(level string) (*readconcern.ReadConcern, error) {
+	switch level {
+	case "local":
+		return readconcern.Local(), nil
+	case "available":
+		return readconcern.Available(), nil
+	case "majority":
+		return readconcern.Majority(), nil
+	case "linearizable":
+		return readconcern.Linearizable(), nil
+	case "snapshot":
+		return readconcern.Snapshot(), nil
+	default:
+		return nil, fmt.Errorf("Unknown read concern %q, expected local, available, majority, linearizable or snapshot", level)
+	}
+}
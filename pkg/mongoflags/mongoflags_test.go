@@ -0,0 +1,65 @@
+package mongoflags
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/tag"
+)
+
+func TestReadPreference(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		tags     string
+		wantMode readpref.Mode
+		wantTags []tag.Set
+		wantNil  bool
+		wantErr  bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "secondary", mode: "secondary", wantMode: readpref.SecondaryMode, wantTags: []tag.Set{}},
+		{name: "tags", mode: "secondaryPreferred", tags: "dc:east,use:reporting;dc:west", wantMode: readpref.SecondaryPreferredMode, wantTags: []tag.Set{
+			{{Name: "dc", Value: "east"}, {Name: "use", Value: "reporting"}},
+			{{Name: "dc", Value: "west"}},
+		}},
+		{name: "unknown mode", mode: "tertiary", wantErr: true},
+		{name: "tags without mode", tags: "dc:east", wantErr: true},
+		{name: "tag without value", mode: "nearest", tags: "dc", wantErr: true},
+		{name: "tags on primary", mode: "primary", tags: "dc:east", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadPreference(tt.mode, tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPreference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantNil {
+				if got != nil {
+					t.Fatalf("ReadPreference() = %v, want nil", got)
+				}
+				return
+			}
+
+			if got.Mode() != tt.wantMode {
+				t.Errorf("ReadPreference().Mode() = %v, want %v", got.Mode(), tt.wantMode)
+			}
+			if tags := got.TagSets(); len(tags) != len(tt.wantTags) || (len(tags) > 0 && !reflect.DeepEqual(tags, tt.wantTags)) {
+				t.Errorf("ReadPreference().TagSets() = %v, want %v", tags, tt.wantTags)
+			}
+		})
+	}
+}
+
+func TestReadConcern(t *testing.T) {
+	if rc, err := ReadConcern("majority"); err != nil || rc == nil {
+		t.Errorf("ReadConcern(majority) = %v, %v", rc, err)
+	}
+	if _, err := ReadConcern("strong"); err == nil {
+		t.Errorf("ReadConcern(strong) error = nil, want an error")
+	}
+}
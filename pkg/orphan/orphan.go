@@ -0,0 +1,225 @@
+package orphan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultBatchSize = 1000
+	defaultSamples   = 10
+)
+
+// Source streams the documents of a referenced collection and tells which of their IDs a referencing path holds,
+// the IDs no path holds are the orphans
+type Source interface {
+	Each(ctx context.Context, db, collection string, fn func(m primitive.M) error) error
+	Referenced(ctx context.Context, db, collection, path string, ids []primitive.ObjectID) ([]primitive.ObjectID, error)
+}
+
+// Report counts the documents of a referenced collection that no link references
+type Report struct {
+	Collection string `json:"collection"`
+	// ReferencedBy are the collection.path of the links referencing Collection
+	ReferencedBy []string `json:"referencedBy"`
+	Total        int      `json:"total"`
+	Orphans      int      `json:"orphans"`
+	// Samples are the _id of the first orphans found
+	Samples []primitive.ObjectID `json:"samples"`
+}
+
+// Ratio returns the ratio of orphans among the documents of the collection
+func (r Report) Ratio() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+
+	return float64(r.Orphans) / float64(r.Total)
+}
+
+// OptionF describes a func that will be called from the Find func
+type OptionF func(*finder)
+
+// WithBatchSize sets how many IDs each query looks for, 1000 by default
+func WithBatchSize(n int) OptionF {
+	return func(f *finder) {
+		f.batchSize = n
+	}
+}
+
+// WithSamples sets how many orphans are listed by collection, 10 by default
+func WithSamples(n int) OptionF {
+	return func(f *finder) {
+		f.samples = n
+	}
+}
+
+type finder struct {
+	s         Source
+	db        string
+	batchSize int
+	samples   int
+}
+
+// reference is a link of a collection of db
+type reference struct {
+	collection string
+	path       string
+}
+
+// Find streams every collection of db referenced by links and looks its IDs up in all the link paths referencing it,
+// batch by batch. Only the discovered links count, a document only referenced by a path the scan missed is an orphan.
+// Collections with the most orphans come first
+func Find(ctx context.Context, s Source, db string, links map[string]discover.CollectionLinks, opts ...OptionF) ([]Report, error) {
+	f := finder{s: s, db: db, batchSize: defaultBatchSize, samples: defaultSamples}
+	for _, o := range opts {
+		o(&f)
+	}
+	if f.batchSize < 1 {
+		f.batchSize = 1
+	}
+
+	refs := map[string][]reference{}
+	for c, cl := range links {
+		for _, l := range cl {
+			for _, w := range l.With {
+				if t := strings.TrimPrefix(w, db+"."); t != w {
+					refs[t] = append(refs[t], reference{collection: c, path: l.Path})
+				}
+			}
+		}
+	}
+
+	targets := make([]string, 0, len(refs))
+	for t := range refs {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	rs := make([]Report, 0, len(targets))
+	for _, t := range targets {
+		sort.Slice(refs[t], func(i, j int) bool {
+			if refs[t][i].collection != refs[t][j].collection {
+				return refs[t][i].collection < refs[t][j].collection
+			}
+
+			return refs[t][i].path < refs[t][j].path
+		})
+
+		r, err := f.collection(ctx, t, refs[t])
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+
+	sort.SliceStable(rs, func(i, j int) bool {
+		return rs[i].Orphans > rs[j].Orphans
+	})
+
+	return rs, nil
+}
+
+// collection reports the orphans of collection, referenced by refs
+func (f finder) collection(ctx context.Context, collection string, refs []reference) (Report, error) {
+	r := Report{Collection: collection, Samples: []primitive.ObjectID{}}
+	for _, ref := range refs {
+		r.ReferencedBy = append(r.ReferencedBy, ref.collection+"."+ref.path)
+	}
+
+	batch := make([]primitive.ObjectID, 0, f.batchSize)
+	err := f.s.Each(ctx, f.db, collection, func(m primitive.M) error {
+		id, ok := m["_id"].(primitive.ObjectID)
+		if !ok {
+			return nil
+		}
+
+		batch = append(batch, id)
+		if len(batch) < f.batchSize {
+			return nil
+		}
+
+		err := f.batch(ctx, &r, batch, refs)
+		batch = batch[:0]
+		return err
+	})
+	if err == nil {
+		err = f.batch(ctx, &r, batch, refs)
+	}
+	if err != nil {
+		return r, fmt.Errorf("Error during finding orphans of %s.%s: %w", f.db, collection, err)
+	}
+
+	return r, nil
+}
+
+// batch adds to r the IDs of batch that none of refs references
+func (f finder) batch(ctx context.Context, r *Report, batch []primitive.ObjectID, refs []reference) error {
+	if len(batch) == 0 {
+		return nil
+	}
+	r.Total += len(batch)
+
+	left := make(map[primitive.ObjectID]struct{}, len(batch))
+	for _, id := range batch {
+		left[id] = struct{}{}
+	}
+
+	for _, ref := range refs {
+		if len(left) == 0 {
+			break
+		}
+
+		ids := make([]primitive.ObjectID, 0, len(left))
+		for _, id := range batch {
+			if _, ok := left[id]; ok {
+				ids = append(ids, id)
+			}
+		}
+
+		found, err := f.s.Referenced(ctx, f.db, ref.collection, ref.path, ids)
+		if err != nil {
+			return err
+		}
+		for _, id := range found {
+			delete(left, id)
+		}
+	}
+
+	r.Orphans += len(left)
+	for _, id := range batch {
+		if _, ok := left[id]; ok && len(r.Samples) < f.samples {
+			r.Samples = append(r.Samples, id)
+		}
+	}
+
+	return nil
+}
+
+// Write prints rs, the sample of orphans under each collection
+func Write(w io.Writer, db string, rs []Report) error {
+	var b strings.Builder
+	if len(rs) == 0 {
+		fmt.Fprintf(&b, "No collection of %s is referenced.\n", db)
+	}
+
+	for _, r := range rs {
+		fmt.Fprintf(&b, "%s.%s: %d of %d documents referenced by nothing (%.1f%%), referenced by %s\n",
+			db, r.Collection, r.Orphans, r.Total, 100*r.Ratio(), strings.Join(r.ReferencedBy, ", "))
+		for _, id := range r.Samples {
+			fmt.Fprintf(&b, "  %s\n", id.Hex())
+		}
+		if more := r.Orphans - len(r.Samples); more > 0 {
+			fmt.Fprintf(&b, "  ... and %d more\n", more)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
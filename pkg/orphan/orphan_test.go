@@ -0,0 +1,60 @@
+package orphan
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestFind(t *testing.T) {
+	ctx := context.Background()
+	users := []primitive.ObjectID{}
+	f := inmem.New(0)
+	for i := 0; i < 5; i++ {
+		users = append(users, primitive.NewObjectID())
+		f.Insert("shop", "users", primitive.M{"_id": users[i]})
+	}
+	team := primitive.NewObjectID()
+	f.Insert("shop", "teams", primitive.M{"_id": team, "memberIds": primitive.A{users[1], users[2].Hex()}}).
+		Insert("shop", "orders", primitive.M{"_id": primitive.NewObjectID(), "userId": users[0], "teamId": team})
+
+	links := map[string]discover.CollectionLinks{
+		"orders": {
+			"userId": {Path: "userId", With: []string{"shop.users"}},
+			"teamId": {Path: "teamId", With: []string{"shop.teams"}},
+		},
+		"teams": {
+			"memberIds.$": {Path: "memberIds.$", With: []string{"shop.users"}},
+			"archiveId":   {Path: "archiveId", With: []string{"archive.users"}},
+		},
+	}
+
+	got, err := Find(ctx, f, "shop", links, WithBatchSize(2), WithSamples(1))
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+
+	want := []Report{
+		{Collection: "users", ReferencedBy: []string{"orders.userId", "teams.memberIds.$"}, Total: 5, Orphans: 2, Samples: []primitive.ObjectID{users[3]}},
+		{Collection: "teams", ReferencedBy: []string{"orders.teamId"}, Total: 1, Orphans: 0, Samples: []primitive.ObjectID{}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Find() = %+v, want %+v", got, want)
+	}
+
+	var b bytes.Buffer
+	if err := Write(&b, "shop", got); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	for _, s := range []string{"shop.users: 2 of 5 documents referenced by nothing (40.0%)", users[3].Hex(), "... and 1 more"} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Write() = %s, want %s", b.String(), s)
+		}
+	}
+}
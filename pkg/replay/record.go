@@ -0,0 +1,118 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	methodExistsByID       = "ExistsByID"
+	methodListDatabases    = "ListDatabases"
+	methodListCollections  = "ListCollections"
+	methodSampleCollection = "SampleCollection"
+	methodListIndexes      = "ListIndexes"
+	methodEstimatedCount   = "EstimatedCount"
+	methodArrayLengths     = "ArrayLengths"
+)
+
+// record is a single call to a Fetcher and its response, written as one JSON line.
+// Documents are kept as canonical Extended JSON so their BSON types survive the trip
+type record struct {
+	Method     string            `json:"method"`
+	DB         string            `json:"db,omitempty"`
+	Collection string            `json:"collection,omitempty"`
+	ID         string            `json:"id,omitempty"`
+	Path       string            `json:"path,omitempty"`
+	Size       int               `json:"size,omitempty"`
+	Exists     bool              `json:"exists,omitempty"`
+	Names      []string          `json:"names,omitempty"`
+	Docs       []json.RawMessage `json:"docs,omitempty"`
+	Indexes    []json.RawMessage `json:"indexes,omitempty"`
+	Count      int64             `json:"count,omitempty"`
+	Lengths    map[int]int       `json:"lengths,omitempty"`
+	Err        string            `json:"error,omitempty"`
+}
+
+// key identifies a call by its method and arguments
+func (r record) key() string {
+	return callKey(r.Method, r.DB, r.Collection, r.ID, r.Path, r.Size)
+}
+
+func callKey(method, db, collection, id, path string, size int) string {
+	return fmt.Sprintf("%s|%s|%s|%s|%s|%d", method, db, collection, id, path, size)
+}
+
+func encodeDocs(docs []primitive.M) ([]json.RawMessage, error) {
+	raws := make([]json.RawMessage, 0, len(docs))
+	for _, d := range docs {
+		b, err := bson.MarshalExtJSON(d, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("Error during encoding document: %w", err)
+		}
+
+		raws = append(raws, b)
+	}
+
+	return raws, nil
+}
+
+func decodeDocs(raws []json.RawMessage) ([]primitive.M, error) {
+	docs := make([]primitive.M, 0, len(raws))
+	for _, raw := range raws {
+		m := primitive.M{}
+		if err := bson.UnmarshalExtJSON(raw, true, &m); err != nil {
+			return nil, fmt.Errorf("Error during decoding document: %w", err)
+		}
+
+		docs = append(docs, m)
+	}
+
+	return docs, nil
+}
+
+func encodeIndexes(indexes []primitive.D) ([]json.RawMessage, error) {
+	raws := make([]json.RawMessage, 0, len(indexes))
+	for _, i := range indexes {
+		b, err := bson.MarshalExtJSON(i, true, false)
+		if err != nil {
+			return nil, fmt.Errorf("Error during encoding index: %w", err)
+		}
+
+		raws = append(raws, b)
+	}
+
+	return raws, nil
+}
+
+// decodeIndexes keeps indexes as primitive.D so the order of their keys survives
+func decodeIndexes(raws []json.RawMessage) ([]primitive.D, error) {
+	indexes := make([]primitive.D, 0, len(raws))
+	for _, raw := range raws {
+		i := primitive.D{}
+		if err := bson.UnmarshalExtJSON(raw, true, &i); err != nil {
+			return nil, fmt.Errorf("Error during decoding index: %w", err)
+		}
+
+		indexes = append(indexes, i)
+	}
+
+	return indexes, nil
+}
+
+// errorString keeps the message of err, the only part of an error that can be replayed
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
+
+// canceled reports whether a call ended because of its context, such answers are meaningless to replay
+func canceled(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
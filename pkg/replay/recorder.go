@@ -0,0 +1,268 @@
+package replay
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Recorder is a discover.Fetcher decorator writing every call and its response to a stream
+type Recorder struct {
+	next discover.Fetcher
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+
+	redact bool
+	salt   []byte
+}
+
+// RecorderOptionF describes a func that will be called from the NewRecorder func
+type RecorderOptionF func(*Recorder)
+
+// RecorderWithRedaction hashes every ObjectId with salt and replaces all other values
+// by placeholders of the same type, so a recording can be shared without its data.
+// IDs are hashed consistently so the links between documents still hold on replay
+func RecorderWithRedaction(salt []byte) RecorderOptionF {
+	return func(r *Recorder) {
+		r.redact = true
+		r.salt = salt
+	}
+}
+
+// NewRecorder creates a Recorder calling f and writing to w
+func NewRecorder(f discover.Fetcher, w io.Writer, opts ...RecorderOptionF) *Recorder {
+	r := &Recorder{next: f, enc: json.NewEncoder(w)}
+
+	for _, o := range opts {
+		o(r)
+	}
+
+	return r
+}
+
+// Err returns the first error that happened while writing the recording
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+func (r *Recorder) write(rec record) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	if err := r.enc.Encode(rec); err != nil {
+		r.err = fmt.Errorf("Error during writing recording: %w", err)
+	}
+}
+
+// fail keeps err unless an error already happened
+func (r *Recorder) fail(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = err
+	}
+}
+
+// ExistsByID calls the decorated Fetcher and records the answer
+func (r *Recorder) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	exists, err := r.next.ExistsByID(ctx, db, collection, id)
+	if canceled(ctx) {
+		return exists, err
+	}
+
+	r.write(record{Method: methodExistsByID, DB: db, Collection: collection, ID: r.hashID(id).Hex(), Exists: exists, Err: errorString(err)})
+	return exists, err
+}
+
+// ListDatabases calls the decorated Fetcher and records the answer
+func (r *Recorder) ListDatabases(ctx context.Context) ([]string, error) {
+	dbs, err := r.next.ListDatabases(ctx)
+	if canceled(ctx) {
+		return dbs, err
+	}
+
+	r.write(record{Method: methodListDatabases, Names: dbs, Err: errorString(err)})
+	return dbs, err
+}
+
+// ListCollections calls the decorated Fetcher and records the answer
+func (r *Recorder) ListCollections(ctx context.Context, db string) ([]string, error) {
+	cls, err := r.next.ListCollections(ctx, db)
+	if canceled(ctx) {
+		return cls, err
+	}
+
+	r.write(record{Method: methodListCollections, DB: db, Names: cls, Err: errorString(err)})
+	return cls, err
+}
+
+// SampleCollection calls the decorated Fetcher and records the documents, redacted if asked
+func (r *Recorder) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	docs, err := r.next.SampleCollection(ctx, db, collection, size)
+	if canceled(ctx) {
+		return docs, err
+	}
+
+	rec := record{Method: methodSampleCollection, DB: db, Collection: collection, Size: size, Err: errorString(err)}
+	recorded := docs
+	if r.redact {
+		recorded = make([]primitive.M, 0, len(docs))
+		for _, d := range docs {
+			recorded = append(recorded, r.redactValue(d).(primitive.M))
+		}
+	}
+
+	raws, encErr := encodeDocs(recorded)
+	if encErr != nil {
+		r.fail(encErr)
+		return docs, err
+	}
+
+	rec.Docs = raws
+	r.write(rec)
+	return docs, err
+}
+
+// ListIndexes calls the decorated Fetcher and records the indexes, their keys are field names and are never redacted
+func (r *Recorder) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	l, ok := r.next.(discover.IndexLister)
+	if !ok {
+		return nil, fmt.Errorf("ListIndexes: %w", discover.ErrUnsupported)
+	}
+
+	indexes, err := l.ListIndexes(ctx, db, collection)
+	if canceled(ctx) {
+		return indexes, err
+	}
+
+	raws, encErr := encodeIndexes(indexes)
+	if encErr != nil {
+		r.fail(encErr)
+		return indexes, err
+	}
+
+	r.write(record{Method: methodListIndexes, DB: db, Collection: collection, Indexes: raws, Err: errorString(err)})
+	return indexes, err
+}
+
+// EstimatedCount calls the decorated Fetcher and records the answer
+func (r *Recorder) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	l, ok := r.next.(discover.IndexLister)
+	if !ok {
+		return 0, fmt.Errorf("EstimatedCount: %w", discover.ErrUnsupported)
+	}
+
+	n, err := l.EstimatedCount(ctx, db, collection)
+	if canceled(ctx) {
+		return n, err
+	}
+
+	r.write(record{Method: methodEstimatedCount, DB: db, Collection: collection, Count: n, Err: errorString(err)})
+	return n, err
+}
+
+// ArrayLengths calls the decorated Fetcher and records the answer, the path is a field name and is never redacted
+func (r *Recorder) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	c, ok := r.next.(discover.ArrayCounter)
+	if !ok {
+		return nil, fmt.Errorf("ArrayLengths: %w", discover.ErrUnsupported)
+	}
+
+	lengths, err := c.ArrayLengths(ctx, db, collection, path)
+	if canceled(ctx) {
+		return lengths, err
+	}
+
+	r.write(record{Method: methodArrayLengths, DB: db, Collection: collection, Path: path, Lengths: lengths, Err: errorString(err)})
+	return lengths, err
+}
+
+// hashID derives a stable ObjectId from id and the salt, id is kept when redaction is off
+func (r *Recorder) hashID(id primitive.ObjectID) primitive.ObjectID {
+	if !r.redact {
+		return id
+	}
+
+	h := sha256.New()
+	h.Write(r.salt)
+	h.Write(id[:])
+
+	var hashed primitive.ObjectID
+	copy(hashed[:], h.Sum(nil))
+	return hashed
+}
+
+// redactValue keeps the shape and types of v while removing its content
+func (r *Recorder) redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case primitive.M:
+		m := make(primitive.M, len(t))
+		for k, e := range t {
+			m[k] = r.redactValue(e)
+		}
+		return m
+	case primitive.A:
+		a := make(primitive.A, 0, len(t))
+		for _, e := range t {
+			a = append(a, r.redactValue(e))
+		}
+		return a
+	case primitive.D:
+		d := make(primitive.D, 0, len(t))
+		for _, e := range t {
+			d = append(d, primitive.E{Key: e.Key, Value: r.redactValue(e.Value)})
+		}
+		return d
+	case primitive.ObjectID:
+		return r.hashID(t)
+	case string:
+		if id, err := primitive.ObjectIDFromHex(t); err == nil {
+			return r.hashID(id).Hex()
+		}
+
+		// 16 characters can't be mistaken for an ObjectId
+		h := sha256.New()
+		h.Write(r.salt)
+		h.Write([]byte(t))
+		return hex.EncodeToString(h.Sum(nil))[:16]
+	case int32:
+		return int32(0)
+	case int64:
+		return int64(0)
+	case float64:
+		return float64(0)
+	case bool:
+		return false
+	case primitive.DateTime:
+		return primitive.DateTime(0)
+	case primitive.Timestamp:
+		return primitive.Timestamp{}
+	case primitive.Decimal128:
+		return primitive.NewDecimal128(0, 0)
+	case primitive.Binary:
+		return primitive.Binary{Subtype: t.Subtype}
+	case nil:
+		return nil
+	default:
+		// Any other scalar, e.g. an int, a float32 or a primitive.Regex, keeps its type with a zero value
+		return reflect.Zero(reflect.TypeOf(v)).Interface()
+	}
+}
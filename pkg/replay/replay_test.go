@@ -0,0 +1,105 @@
+package replay
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+
+	aID := primitive.NewObjectID()
+	bID := primitive.NewObjectID()
+	f := inmem.New(1).
+		Insert("db", "A", primitive.M{"_id": aID, "email": "someone@example.com"}).
+		Insert("db", "B", primitive.M{"_id": bID, "aId": aID, "aIdStr": aID.Hex(), "n": int32(3), "active": true})
+
+	tests := []struct {
+		name string
+		opts []RecorderOptionF
+	}{
+		{name: "plain recording"},
+		{name: "redacted recording", opts: []RecorderOptionF{RecorderWithRedaction([]byte("salt"))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := discover.New(ctx, f)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			want, err := d.Database(ctx, "db")
+			if err != nil {
+				t.Fatalf("Discover.Database() error = %v", err)
+			}
+
+			buf := &bytes.Buffer{}
+			rec := NewRecorder(f, buf, tt.opts...)
+			d, err = discover.New(ctx, rec)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if _, err := d.Database(ctx, "db"); err != nil {
+				t.Fatalf("Discover.Database() with Recorder error = %v", err)
+			}
+			if err := rec.Err(); err != nil {
+				t.Fatalf("Recorder.Err() = %v", err)
+			}
+
+			if len(tt.opts) > 0 && (bytes.Contains(buf.Bytes(), []byte(aID.Hex())) || bytes.Contains(buf.Bytes(), []byte("example.com")) || bytes.Contains(buf.Bytes(), []byte(`"active":true`))) {
+				t.Errorf("redacted recording leaks original values: %s", buf.String())
+			}
+
+			rp, err := NewReplayer(buf)
+			if err != nil {
+				t.Fatalf("NewReplayer() error = %v", err)
+			}
+
+			d, err = discover.New(ctx, rp)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			got, err := d.Database(ctx, "db")
+			if err != nil {
+				t.Fatalf("Discover.Database() with Replayer error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("replayed Discover.Database() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRecorder_redactValue(t *testing.T) {
+	r := NewRecorder(inmem.New(0), &bytes.Buffer{}, RecorderWithRedaction([]byte("salt")))
+
+	tests := []struct {
+		name string
+		v    interface{}
+		want interface{}
+	}{
+		{name: "int", v: 42, want: 0},
+		{name: "float32", v: float32(1.5), want: float32(0)},
+		{name: "regex", v: primitive.Regex{Pattern: "^secret", Options: "i"}, want: primitive.Regex{}},
+		{name: "null", v: nil, want: nil},
+		{name: "bool", v: true, want: false},
+		{name: "ordered document", v: primitive.D{{Key: "b", Value: int32(7)}, {Key: "a", Value: 3}},
+			want: primitive.D{{Key: "b", Value: int32(0)}, {Key: "a", Value: 0}}},
+		{name: "nested in a map", v: primitive.M{"d": primitive.D{{Key: "n", Value: int64(9)}}},
+			want: primitive.M{"d": primitive.D{{Key: "n", Value: int64(0)}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.redactValue(tt.v); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactValue(%#v) = %#v, want %#v", tt.v, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrNotRecorded is returned when a call was never recorded
+var ErrNotRecorded = errors.New("call not recorded")
+
+// Replayer is a discover.Fetcher answering with the responses of a recording
+type Replayer struct {
+	records map[string]record
+}
+
+// NewReplayer reads a recording made by a Recorder
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{records: map[string]record{}}
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+	for n := 0; ; n++ {
+		rec := record{}
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("Error during reading record %d: %w", n, err)
+		}
+
+		rp.records[rec.key()] = rec
+	}
+
+	return rp, nil
+}
+
+func (rp *Replayer) lookup(method, db, collection, id, path string, size int) (record, error) {
+	rec, ok := rp.records[callKey(method, db, collection, id, path, size)]
+	if !ok {
+		return rec, fmt.Errorf("%w: %s(%s, %s, %s, %s, %d)", ErrNotRecorded, method, db, collection, id, path, size)
+	}
+
+	if rec.Err != "" {
+		return rec, errors.New(rec.Err)
+	}
+
+	return rec, nil
+}
+
+// ExistsByID answers false for IDs that were never probed during the recording
+func (rp *Replayer) ExistsByID(ctx context.Context, db, collection string, id primitive.ObjectID) (bool, error) {
+	rec, err := rp.lookup(methodExistsByID, db, collection, id.Hex(), "", 0)
+	if errors.Is(err, ErrNotRecorded) {
+		return false, nil
+	}
+
+	return rec.Exists, err
+}
+
+// ListDatabases returns the recorded database names
+func (rp *Replayer) ListDatabases(ctx context.Context) ([]string, error) {
+	rec, err := rp.lookup(methodListDatabases, "", "", "", "", 0)
+	return rec.Names, err
+}
+
+// ListCollections returns the recorded collection names of db
+func (rp *Replayer) ListCollections(ctx context.Context, db string) ([]string, error) {
+	rec, err := rp.lookup(methodListCollections, db, "", "", "", 0)
+	return rec.Names, err
+}
+
+// SampleCollection returns the recorded sample of db.collection
+func (rp *Replayer) SampleCollection(ctx context.Context, db, collection string, size int) ([]primitive.M, error) {
+	rec, err := rp.lookup(methodSampleCollection, db, collection, "", "", size)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeDocs(rec.Docs)
+}
+
+// ListIndexes returns the recorded indexes of db.collection
+func (rp *Replayer) ListIndexes(ctx context.Context, db, collection string) ([]primitive.D, error) {
+	rec, err := rp.lookup(methodListIndexes, db, collection, "", "", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeIndexes(rec.Indexes)
+}
+
+// EstimatedCount returns the recorded count of db.collection
+func (rp *Replayer) EstimatedCount(ctx context.Context, db, collection string) (int64, error) {
+	rec, err := rp.lookup(methodEstimatedCount, db, collection, "", "", 0)
+	return rec.Count, err
+}
+
+// ArrayLengths returns the recorded lengths of the arrays at path in db.collection
+func (rp *Replayer) ArrayLengths(ctx context.Context, db, collection, path string) (map[int]int, error) {
+	rec, err := rp.lookup(methodArrayLengths, db, collection, "", path, 0)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Lengths == nil {
+		return map[int]int{}, nil
+	}
+
+	return rec.Lengths, nil
+}
@@ -0,0 +1,51 @@
+package schema
+
+import (
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Collector is a discover.SampleObserver inferring the schema of every collection from the samples of a scan
+type Collector struct {
+	mu   sync.Mutex
+	docs map[string]*Document
+}
+
+// NewCollector returns an empty Collector
+func NewCollector() *Collector {
+	return &Collector{docs: map[string]*Document{}}
+}
+
+// Samples implements discover.SampleObserver
+func (c *Collector) Samples(db, collection string, samples []primitive.M) {
+	d := Infer(samples)
+
+	c.mu.Lock()
+	c.docs[db+"."+collection] = d
+	c.mu.Unlock()
+}
+
+// Collection returns the schema of db.collection, nil if it was not sampled
+func (c *Collector) Collection(db, collection string) *Document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.docs[db+"."+collection]
+}
+
+// Database returns the schemas of all sampled collections of db by collection name
+func (c *Collector) Database(db string) map[string]*Document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := map[string]*Document{}
+	for k, d := range c.docs {
+		if strings.HasPrefix(k, db+".") {
+			m[strings.TrimPrefix(k, db+".")] = d
+		}
+	}
+
+	return m
+}
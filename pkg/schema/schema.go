@@ -0,0 +1,303 @@
+package schema
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Type is the BSON type of a value, named like the $type aliases of MongoDB
+type Type string
+
+// All the types reported by Infer
+const (
+	TypeObjectID  Type = "objectId"
+	TypeString    Type = "string"
+	TypeInt       Type = "int"
+	TypeLong      Type = "long"
+	TypeDouble    Type = "double"
+	TypeDecimal   Type = "decimal"
+	TypeBool      Type = "bool"
+	TypeDate      Type = "date"
+	TypeTimestamp Type = "timestamp"
+	TypeBinary    Type = "binData"
+	TypeNull      Type = "null"
+	TypeObject    Type = "object"
+	TypeArray     Type = "array"
+	TypeOther     Type = "other"
+)
+
+// maxValues is how many distinct strings a Field keeps track of
+const maxValues = 32
+
+// Document is the merge of many documents
+type Document struct {
+	Count  int               `json:"count"`
+	Fields map[string]*Field `json:"fields"`
+}
+
+// Field is the merge of all values found under a name, or of all elements of an array
+type Field struct {
+	// Count is the number of values seen, the presence ratio is Count over the Count of the parent
+	Count int          `json:"count"`
+	Types map[Type]int `json:"types"`
+	// Doc merges the values of type object
+	Doc *Document `json:"doc,omitempty"`
+	// Items merges the elements of the values of type array and Lengths counts these arrays by length
+	Items   *Field      `json:"items,omitempty"`
+	Lengths map[int]int `json:"lengths,omitempty"`
+	// Values counts the distinct strings, up to maxValues of them, Truncated tells there were more
+	Values    map[string]int `json:"values,omitempty"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// NewDocument returns an empty Document
+func NewDocument() *Document {
+	return &Document{Fields: map[string]*Field{}}
+}
+
+// Infer merges docs into a Document
+func Infer(docs []primitive.M) *Document {
+	d := NewDocument()
+	for _, m := range docs {
+		d.Add(m)
+	}
+
+	return d
+}
+
+// Add merges m into d
+func (d *Document) Add(m primitive.M) {
+	d.Count++
+	for k, v := range m {
+		f, ok := d.Fields[k]
+		if !ok {
+			f = &Field{Types: map[Type]int{}}
+			d.Fields[k] = f
+		}
+
+		f.add(v)
+	}
+}
+
+func (f *Field) add(v interface{}) {
+	t := TypeOf(v)
+	f.Count++
+	f.Types[t]++
+
+	switch t {
+	case TypeString:
+		f.addValue(v.(string))
+	case TypeObject:
+		if f.Doc == nil {
+			f.Doc = NewDocument()
+		}
+		f.Doc.Add(toM(v))
+	case TypeArray:
+		if f.Items == nil {
+			f.Items = &Field{Types: map[Type]int{}}
+			f.Lengths = map[int]int{}
+		}
+		f.Lengths[len(v.(primitive.A))]++
+		for _, e := range v.(primitive.A) {
+			f.Items.add(e)
+		}
+	}
+}
+
+func (f *Field) addValue(s string) {
+	if f.Values == nil {
+		f.Values = map[string]int{}
+	}
+
+	if _, ok := f.Values[s]; !ok && len(f.Values) >= maxValues {
+		f.Truncated = true
+		return
+	}
+
+	f.Values[s]++
+}
+
+// toM converts both document representations of the driver to a primitive.M
+func toM(v interface{}) primitive.M {
+	if d, ok := v.(primitive.D); ok {
+		return d.Map()
+	}
+
+	return v.(primitive.M)
+}
+
+// TypeOf returns the BSON type of a decoded value
+func TypeOf(v interface{}) Type {
+	switch v.(type) {
+	case primitive.ObjectID:
+		return TypeObjectID
+	case string:
+		return TypeString
+	case int32:
+		return TypeInt
+	case int64:
+		return TypeLong
+	case float64:
+		return TypeDouble
+	case primitive.Decimal128:
+		return TypeDecimal
+	case bool:
+		return TypeBool
+	case primitive.DateTime:
+		return TypeDate
+	case primitive.Timestamp:
+		return TypeTimestamp
+	case primitive.Binary:
+		return TypeBinary
+	case nil, primitive.Null, primitive.Undefined:
+		return TypeNull
+	case primitive.M, primitive.D:
+		return TypeObject
+	case primitive.A:
+		return TypeArray
+	default:
+		return TypeOther
+	}
+}
+
+// Names returns the field names of d sorted
+func (d *Document) Names() []string {
+	ns := make([]string, 0, len(d.Fields))
+	for n := range d.Fields {
+		ns = append(ns, n)
+	}
+	sort.Strings(ns)
+
+	return ns
+}
+
+// FieldAt returns the field found at the link path, a $ going to the elements of an array, nil when there is none
+func (d *Document) FieldAt(path string) *Field {
+	var f *Field
+	for _, s := range strings.Split(path, ".") {
+		switch {
+		case s == "$" && f != nil:
+			f = f.Items
+		case f == nil && d != nil:
+			f = d.Fields[s]
+		case f != nil && f.Doc != nil:
+			f = f.Doc.Fields[s]
+		default:
+			return nil
+		}
+
+		if f == nil {
+			return nil
+		}
+	}
+
+	return f
+}
+
+// Presence returns the ratio of documents of d having the field name
+func (d *Document) Presence(name string) float64 {
+	f, ok := d.Fields[name]
+	if !ok || d.Count == 0 {
+		return 0
+	}
+
+	return float64(f.Count) / float64(d.Count)
+}
+
+// Optional reports whether the field name is missing from some documents of d
+func (d *Document) Optional(name string) bool {
+	f, ok := d.Fields[name]
+	return !ok || f.Count < d.Count
+}
+
+// Nullable reports whether some values of f are null
+func (f *Field) Nullable() bool {
+	return f.Types[TypeNull] > 0
+}
+
+// Dominant returns the single type of all non null values of f.
+// Numbers of different sizes are widened, any other mix is TypeOther and only nulls is TypeNull
+func (f *Field) Dominant() Type {
+	types := []Type{}
+	for t := range f.Types {
+		if t != TypeNull {
+			types = append(types, t)
+		}
+	}
+
+	switch len(types) {
+	case 0:
+		return TypeNull
+	case 1:
+		return types[0]
+	}
+
+	widest := TypeOther
+	for _, t := range types {
+		switch {
+		case t == TypeDouble || (t == TypeLong && widest != TypeDouble) || (t == TypeInt && widest == TypeOther):
+			widest = t
+		case t != TypeInt && t != TypeLong:
+			return TypeOther
+		}
+	}
+
+	return widest
+}
+
+// Distribution summarises a set of lengths
+type Distribution struct {
+	Count  int     `json:"count"`
+	Min    int     `json:"min"`
+	Median int     `json:"median"`
+	P99    int     `json:"p99"`
+	Max    int     `json:"max"`
+	Mean   float64 `json:"mean"`
+}
+
+// NewDistribution summarises lengths, counted by length
+func NewDistribution(lengths map[int]int) Distribution {
+	ls := make([]int, 0, len(lengths))
+	d := Distribution{}
+	sum := 0
+	for l, n := range lengths {
+		if n <= 0 {
+			continue
+		}
+		ls = append(ls, l)
+		d.Count += n
+		sum += l * n
+	}
+	if d.Count == 0 {
+		return d
+	}
+	sort.Ints(ls)
+
+	d.Min, d.Max = ls[0], ls[len(ls)-1]
+	d.Mean = float64(sum) / float64(d.Count)
+
+	// Nearest rank percentiles
+	median := int(math.Ceil(0.5 * float64(d.Count)))
+	p99 := int(math.Ceil(0.99 * float64(d.Count)))
+	seen := 0
+	for _, l := range ls {
+		prev := seen
+		seen += lengths[l]
+		if prev < median && seen >= median {
+			d.Median = l
+		}
+		if prev < p99 && seen >= p99 {
+			d.P99 = l
+		}
+	}
+
+	return d
+}
+
+// LengthDistribution summarises the lengths of the arrays of f
+func (f *Field) LengthDistribution() Distribution {
+	return NewDistribution(f.Lengths)
+}
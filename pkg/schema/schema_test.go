@@ -0,0 +1,97 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewDistribution(t *testing.T) {
+	tests := []struct {
+		name    string
+		lengths map[int]int
+		want    Distribution
+	}{
+		{name: "empty", lengths: map[int]int{}, want: Distribution{}},
+		{name: "no count", lengths: map[int]int{3: 0}, want: Distribution{}},
+		{name: "single array", lengths: map[int]int{5: 1}, want: Distribution{Count: 1, Min: 5, Median: 5, P99: 5, Max: 5, Mean: 5}},
+		{name: "ties", lengths: map[int]int{2: 4}, want: Distribution{Count: 4, Min: 2, Median: 2, P99: 2, Max: 2, Mean: 2}},
+		{name: "zero length arrays", lengths: map[int]int{0: 3, 4: 1}, want: Distribution{Count: 4, Min: 0, Median: 0, P99: 4, Max: 4, Mean: 1}},
+		{name: "median on the boundary", lengths: map[int]int{1: 2, 3: 2}, want: Distribution{Count: 4, Min: 1, Median: 1, P99: 3, Max: 3, Mean: 2}},
+		{name: "p99 outlier", lengths: map[int]int{1: 99, 50: 1}, want: Distribution{Count: 100, Min: 1, Median: 1, P99: 1, Max: 50, Mean: 1.49}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewDistribution(tt.lengths); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewDistribution() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestField_Lengths(t *testing.T) {
+	d := Infer([]primitive.M{
+		{"tags": primitive.A{"a", "b"}, "lines": primitive.A{primitive.M{"ids": primitive.A{}}}},
+		{"tags": primitive.A{}, "lines": primitive.A{primitive.M{"ids": primitive.A{1, 2, 3}}, primitive.M{"ids": primitive.A{}}}},
+		{"tags": primitive.A{"c", "d"}, "lines": nil},
+		{},
+	})
+
+	tests := []struct {
+		name string
+		f    *Field
+		want map[int]int
+	}{
+		{name: "tags", f: d.Fields["tags"], want: map[int]int{0: 1, 2: 2}},
+		{name: "lines", f: d.Fields["lines"], want: map[int]int{1: 1, 2: 1}},
+		{name: "ids of the lines", f: d.Fields["lines"].Items.Doc.Fields["ids"], want: map[int]int{0: 2, 3: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.f.Lengths, tt.want) {
+				t.Errorf("Lengths = %v, want %v", tt.f.Lengths, tt.want)
+			}
+		})
+	}
+}
+
+func TestDocument_FieldAt(t *testing.T) {
+	d := Infer([]primitive.M{
+		{
+			"name":     "Alice",
+			"address":  primitive.M{"city": "Paris"},
+			"tags":     primitive.A{"a"},
+			"lines":    primitive.A{primitive.M{"itemId": primitive.NewObjectID()}},
+			"matrix":   primitive.A{primitive.A{int32(1)}},
+			"boxes":    primitive.A{primitive.A{primitive.M{"tagId": "t"}}},
+			"optional": nil,
+		},
+	})
+
+	tests := []struct {
+		path string
+		want *Field
+	}{
+		{path: "name", want: d.Fields["name"]},
+		{path: "address.city", want: d.Fields["address"].Doc.Fields["city"]},
+		{path: "tags.$", want: d.Fields["tags"].Items},
+		{path: "lines.$.itemId", want: d.Fields["lines"].Items.Doc.Fields["itemId"]},
+		{path: "matrix.$.$", want: d.Fields["matrix"].Items.Items},
+		{path: "boxes.$.$.tagId", want: d.Fields["boxes"].Items.Items.Doc.Fields["tagId"]},
+		{path: "missing"},
+		{path: "address.zip"},
+		{path: "name.first"},
+		{path: "name.$"},
+		{path: "lines.itemId"},
+		{path: "$"},
+		{path: "optional.$"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := d.FieldAt(tt.path); got != tt.want {
+				t.Errorf("FieldAt() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package seeder
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultMax  = 1000
+	defaultSkew = 1.2
+	wordLetters = "abcdefghijklmnopqrstuvwxyz"
+)
+
+// dateOrigin is the earliest generated date, dates spread over the year after it
+var dateOrigin = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator builds the documents of a Spec, references point to the documents it generates unless they dangle
+type Generator struct {
+	spec *Spec
+	rnd  *rand.Rand
+	ids  map[string][]primitive.ObjectID
+	// zipfs are the skewed pickers of the references by collection and skew
+	zipfs map[string]map[float64]*rand.Zipf
+}
+
+// NewGenerator creates a Generator of s, the _id of every document is drawn first so references can point anywhere.
+// Everything, IDs included, only depends on the seed of s so generating twice gives the same documents
+func NewGenerator(s *Spec) (*Generator, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := &Generator{
+		spec:  s,
+		rnd:   rand.New(rand.NewSource(s.Seed)),
+		ids:   map[string][]primitive.ObjectID{},
+		zipfs: map[string]map[float64]*rand.Zipf{},
+	}
+
+	for _, c := range s.Collections {
+		ids := make([]primitive.ObjectID, c.Count)
+		for i := range ids {
+			ids[i] = g.objectID()
+		}
+		g.ids[c.Name] = ids
+	}
+
+	return g, nil
+}
+
+// Generate calls fn with every document of every collection, in the order of the Spec, and stops at the first error
+func (g *Generator) Generate(fn func(collection string, doc primitive.D) error) error {
+	for _, c := range g.spec.Collections {
+		for _, id := range g.ids[c.Name] {
+			doc := primitive.D{{Key: "_id", Value: id}}
+			doc = g.fields(doc, c.Fields)
+
+			if err := fn(c.Name, doc); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// IDs returns the _id of the documents of collection
+func (g *Generator) IDs(collection string) []primitive.ObjectID {
+	return g.ids[collection]
+}
+
+func (g *Generator) fields(doc primitive.D, fs []FieldSpec) primitive.D {
+	for _, f := range fs {
+		if f.Optional > 0 && g.rnd.Float64() < f.Optional {
+			continue
+		}
+
+		if f.Nullable > 0 && g.rnd.Float64() < f.Nullable {
+			doc = append(doc, primitive.E{Key: f.Name, Value: nil})
+			continue
+		}
+
+		if f.Type == TypeRef && f.Discriminator != "" {
+			target := f.Ref[g.rnd.Intn(len(f.Ref))]
+			doc = append(doc,
+				primitive.E{Key: f.Name, Value: g.ref(f, target)},
+				primitive.E{Key: f.Discriminator, Value: target},
+			)
+			continue
+		}
+
+		doc = append(doc, primitive.E{Key: f.Name, Value: g.value(f)})
+	}
+
+	return doc
+}
+
+// value draws a value of f, nulls and missing fields aside
+func (g *Generator) value(f FieldSpec) interface{} {
+	switch f.Type {
+	case TypeObjectID:
+		return g.objectID()
+	case TypeString:
+		if len(f.Values) > 0 {
+			return f.Values[g.rnd.Intn(len(f.Values))]
+		}
+		return g.word()
+	case TypeInt:
+		return int32(g.number(f))
+	case TypeLong:
+		return int64(g.number(f))
+	case TypeDouble:
+		return g.number(f)
+	case TypeBool:
+		return g.rnd.Intn(2) == 1
+	case TypeDate:
+		return primitive.NewDateTimeFromTime(dateOrigin.Add(time.Duration(g.rnd.Int63n(int64(365 * 24 * time.Hour)))))
+	case TypeRef:
+		return g.ref(f, f.Ref[g.rnd.Intn(len(f.Ref))])
+	case TypeObject:
+		return g.fields(primitive.D{}, f.Fields)
+	case TypeArray:
+		n := f.Length.Min
+		if f.Length.Max > f.Length.Min {
+			n += g.rnd.Intn(f.Length.Max - f.Length.Min + 1)
+		}
+
+		a := make(primitive.A, 0, n)
+		for i := 0; i < n; i++ {
+			if f.Items.Nullable > 0 && g.rnd.Float64() < f.Items.Nullable {
+				a = append(a, nil)
+				continue
+			}
+			a = append(a, g.value(*f.Items))
+		}
+		return a
+	default:
+		return nil
+	}
+}
+
+// objectID draws an ObjectId from the seed so a Spec always gives the same IDs,
+// its timestamp spreads over the year after dateOrigin like the dates
+func (g *Generator) objectID() primitive.ObjectID {
+	var id primitive.ObjectID
+	ts := uint32(dateOrigin.Unix() + g.rnd.Int63n(int64(365*24*time.Hour/time.Second)))
+	binary.BigEndian.PutUint32(id[:4], ts)
+	g.rnd.Read(id[4:])
+
+	return id
+}
+
+func (g *Generator) number(f FieldSpec) float64 {
+	min, max := f.Min, f.Max
+	if min == 0 && max == 0 {
+		max = defaultMax
+	}
+
+	return min + g.rnd.Float64()*(max-min)
+}
+
+func (g *Generator) word() string {
+	b := make([]byte, 4+g.rnd.Intn(8))
+	for i := range b {
+		b[i] = wordLetters[g.rnd.Intn(len(wordLetters))]
+	}
+
+	return string(b)
+}
+
+// ref picks a document of target following the fan-out of f, or a missing one for the dangling references,
+// null when target is empty
+func (g *Generator) ref(f FieldSpec, target string) interface{} {
+	ids := g.ids[target]
+	if len(ids) == 0 && f.Dangling == 0 {
+		return nil
+	}
+
+	var id primitive.ObjectID
+	switch {
+	case len(ids) == 0 || (f.Dangling > 0 && g.rnd.Float64() < f.Dangling):
+		id = g.objectID()
+	case f.FanOut == FanOutZipf:
+		id = ids[g.zipf(target, f.Skew, len(ids)).Uint64()]
+	default:
+		id = ids[g.rnd.Intn(len(ids))]
+	}
+
+	if f.AsString {
+		return id.Hex()
+	}
+
+	return id
+}
+
+func (g *Generator) zipf(target string, skew float64, n int) *rand.Zipf {
+	if skew <= 1 {
+		skew = defaultSkew
+	}
+
+	if g.zipfs[target] == nil {
+		g.zipfs[target] = map[float64]*rand.Zipf{}
+	}
+
+	z, ok := g.zipfs[target][skew]
+	if !ok {
+		z = rand.NewZipf(g.rnd, skew, 1, uint64(n-1))
+		g.zipfs[target][skew] = z
+	}
+
+	return z
+}
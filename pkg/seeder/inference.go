@@ -0,0 +1,189 @@
+package seeder
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+)
+
+// SpecFromInference builds a Spec reproducing the inferred schemas and links of db: presence and null ratios,
+// types, the values of enum-like strings and their frequencies, and references with the same targets and Avg.
+// Every collection gets scale times the number of documents sampled from it
+func SpecFromInference(db string, schemas map[string]*schema.Document, links map[string]discover.CollectionLinks, scale float64) *Spec {
+	names := map[string]bool{}
+	for c := range schemas {
+		names[c] = true
+	}
+	for c := range links {
+		names[c] = true
+	}
+
+	cls := make([]string, 0, len(names))
+	for c := range names {
+		cls = append(cls, c)
+	}
+	sort.Strings(cls)
+
+	s := &Spec{Database: db}
+	for _, c := range cls {
+		doc, ok := schemas[c]
+		if !ok {
+			doc = schema.NewDocument()
+		}
+
+		i := inference{db: db, collections: names, links: links[c], total: doc.Count}
+		s.Collections = append(s.Collections, CollectionSpec{
+			Name:   c,
+			Count:  int(math.Round(float64(doc.Count) * scale)),
+			Fields: i.fields(doc, ""),
+		})
+	}
+
+	return s
+}
+
+// inference converts the schema of a collection
+type inference struct {
+	db          string
+	collections map[string]bool
+	links       discover.CollectionLinks
+	// total is the number of documents sampled, the denominator of the Avg of links
+	total int
+}
+
+func (i inference) fields(doc *schema.Document, path string) []FieldSpec {
+	fs := []FieldSpec{}
+	for _, n := range doc.Names() {
+		p := n
+		if path != "" {
+			p = path + "." + n
+		}
+		if p == "_id" {
+			continue
+		}
+
+		f := doc.Fields[n]
+		fs = append(fs, i.field(f, n, p, 1-doc.Presence(n)))
+	}
+
+	return fs
+}
+
+// field converts f found at the link path, optional is the ratio of documents missing it
+func (i inference) field(f *schema.Field, name, path string, optional float64) FieldSpec {
+	fs := FieldSpec{Name: name, Optional: optional}
+	if f.Count > 0 {
+		fs.Nullable = float64(f.Types[schema.TypeNull]) / float64(f.Count)
+	}
+
+	if l, ok := i.links[path]; ok {
+		if ref, ok := i.ref(f, l); ok {
+			ref.Name, ref.Optional, ref.Nullable = fs.Name, fs.Optional, fs.Nullable
+			return ref
+		}
+	}
+
+	switch f.Dominant() {
+	case schema.TypeObjectID:
+		fs.Type = TypeObjectID
+	case schema.TypeInt:
+		fs.Type = TypeInt
+	case schema.TypeLong:
+		fs.Type = TypeLong
+	case schema.TypeDouble, schema.TypeDecimal:
+		fs.Type = TypeDouble
+	case schema.TypeBool:
+		fs.Type = TypeBool
+	case schema.TypeDate, schema.TypeTimestamp:
+		fs.Type = TypeDate
+	case schema.TypeObject:
+		fs.Type = TypeObject
+		fs.Fields = i.fields(f.Doc, path)
+	case schema.TypeArray:
+		fs.Type = TypeArray
+		fs.Items = &FieldSpec{Type: TypeString}
+		if f.Items != nil && f.Items.Count > 0 {
+			items := i.field(f.Items, "", path+".$", 0)
+			fs.Items = &items
+
+			// Lengths are drawn uniformly around the average length
+			avg := float64(f.Items.Count) / float64(f.Types[schema.TypeArray])
+			fs.Length = Range{Max: int(math.Round(2 * avg))}
+		}
+	case schema.TypeNull:
+		fs.Type = TypeString
+		fs.Nullable = 1
+	default:
+		fs.Type = TypeString
+		fs.Values = values(f)
+	}
+
+	if fs.Type == TypeString && fs.Values == nil {
+		fs.Values = values(f)
+	}
+
+	return fs
+}
+
+// ref converts a link, targets outside of db can't be generated and are left to plain ObjectIds
+func (i inference) ref(f *schema.Field, l discover.Link) (FieldSpec, bool) {
+	fs := FieldSpec{Type: TypeRef}
+	for _, w := range l.With {
+		c := strings.TrimPrefix(w, i.db+".")
+		if c != w && i.collections[c] {
+			fs.Ref = append(fs.Ref, c)
+		}
+	}
+	if len(fs.Ref) == 0 {
+		return fs, false
+	}
+	sort.Strings(fs.Ref)
+
+	// Strings and ObjectIds can't be mixed, the most frequent representation wins
+	fs.AsString = f.Types[schema.TypeString] > f.Types[schema.TypeObjectID]
+
+	// Avg is the number of references found over the sampled documents, the values that were not found dangle
+	values := f.Count - f.Types[schema.TypeNull]
+	if values > 0 {
+		found := float64(l.Avg) * float64(i.total) / float64(values)
+		fs.Dangling = math.Max(0, math.Min(1, 1-found))
+	}
+
+	return fs, true
+}
+
+// minEnumRepeats is how many times each distinct string must be seen on average for the field to look like an enum
+const minEnumRepeats = 4
+
+// values repeats every sampled string as many times as it was seen so picking keeps their frequencies.
+// Production strings are only reused by enum-like fields, with few distinct values each seen several times,
+// and a value seen once is never kept. nil when the strings must be generated
+func values(f *schema.Field) []string {
+	n := f.Types[schema.TypeString]
+	if f.Truncated || len(f.Values) == 0 || len(f.Values)*minEnumRepeats > n {
+		return nil
+	}
+
+	keys := make([]string, 0, len(f.Values))
+	for v, seen := range f.Values {
+		if seen > 1 {
+			keys = append(keys, v)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	sort.Strings(keys)
+
+	vs := []string{}
+	for _, k := range keys {
+		for n := 0; n < f.Values[k]; n++ {
+			vs = append(vs, k)
+		}
+	}
+
+	return vs
+}
@@ -3,10 +3,7 @@ package seeder
 import (
 	"context"
 	"fmt"
-	"log"
 
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -17,95 +14,83 @@ const (
 	CollectionC = "C"
 )
 
-// Seed will fill the database with dummy data
-func Seed(ctx context.Context, client *mongo.Client) {
-	d := client.Database(Database)
-	A := d.Collection(CollectionA)
-	B := d.Collection(CollectionB)
-	C := d.Collection(CollectionC)
+// defaultBatchSize is the number of documents sent by InsertMany
+const defaultBatchSize = 1000
 
-	AIds := []primitive.ObjectID{
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-	}
-	BIds := []primitive.ObjectID{
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-	}
-	CIds := []primitive.ObjectID{
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
-		primitive.NewObjectID(),
+// DefaultSpec is the small dataset used to try the inferer: B references A and C references A and many B
+func DefaultSpec() *Spec {
+	return &Spec{
+		Database: Database,
+		Collections: []CollectionSpec{
+			{Name: CollectionA, Count: 3, Fields: []FieldSpec{
+				{Name: "aaaa", Type: TypeInt, Min: 1000, Max: 200000},
+				{Name: "333", Type: TypeString},
+			}},
+			{Name: CollectionB, Count: 14, Fields: []FieldSpec{
+				{Name: "aId", Type: TypeRef, Ref: []string{CollectionA}},
+			}},
+			{Name: CollectionC, Count: 3, Fields: []FieldSpec{
+				{Name: "aId", Type: TypeRef, Ref: []string{CollectionA}},
+				{Name: "bIds", Type: TypeArray, Length: Range{Min: 4, Max: 5}, Items: &FieldSpec{Type: TypeRef, Ref: []string{CollectionB}}},
+			}},
+		},
 	}
+}
+
+// SeedOptionF describes a func that will be called from the Seed func
+type SeedOptionF func(*seedOptions)
+
+type seedOptions struct {
+	reset     bool
+	batchSize int
+}
 
-	As := []interface{}{
-		bson.D{{Key: "_id", Value: AIds[0]}, {Key: "aaaa", Value: 123213}, {Key: "333", Value: "OKOK Aa"}},
-		bson.D{{Key: "_id", Value: AIds[1]}, {Key: "aaa2", Value: 1232}, {Key: "33", Value: "OKOK AaAa"}},
-		bson.D{{Key: "_id", Value: AIds[2]}, {Key: "aaa3", Value: 1232}, {Key: "33a3", Value: "OKOK AaAa3"}},
+// SeedWithReset drops the collections of the Spec before filling them, so only the generated documents remain
+func SeedWithReset() SeedOptionF {
+	return func(o *seedOptions) {
+		o.reset = true
 	}
+}
 
-	Bs := []interface{}{
-		bson.D{{Key: "_id", Value: BIds[0]}, {Key: "aId", Value: AIds[0]}},
-		bson.D{{Key: "_id", Value: BIds[1]}, {Key: "aId", Value: AIds[0]}},
-		bson.D{{Key: "_id", Value: BIds[2]}, {Key: "aId", Value: AIds[0]}},
-		bson.D{{Key: "_id", Value: BIds[3]}, {Key: "aId", Value: AIds[0]}},
-		bson.D{{Key: "_id", Value: BIds[4]}, {Key: "aId", Value: AIds[1]}},
-		bson.D{{Key: "_id", Value: BIds[5]}, {Key: "aId", Value: AIds[1]}},
-		bson.D{{Key: "_id", Value: BIds[6]}, {Key: "aId", Value: AIds[1]}},
-		bson.D{{Key: "_id", Value: BIds[7]}, {Key: "aId", Value: AIds[1]}},
-		bson.D{{Key: "_id", Value: BIds[8]}, {Key: "aId", Value: AIds[1]}},
-		bson.D{{Key: "_id", Value: BIds[9]}, {Key: "aId", Value: AIds[2]}},
-		bson.D{{Key: "_id", Value: BIds[10]}, {Key: "aId", Value: AIds[2]}},
-		bson.D{{Key: "_id", Value: BIds[11]}, {Key: "aId", Value: AIds[2]}},
-		bson.D{{Key: "_id", Value: BIds[12]}, {Key: "aId", Value: AIds[2]}},
-		bson.D{{Key: "_id", Value: BIds[13]}, {Key: "aId", Value: AIds[2]}},
+// SeedWithBatchSize sets how many documents each InsertMany sends
+func SeedWithBatchSize(n int) SeedOptionF {
+	return func(o *seedOptions) {
+		o.batchSize = n
 	}
+}
 
-	Cs := []interface{}{
-		bson.D{{Key: "_id", Value: CIds[0]}, {Key: "aId", Value: AIds[0]}, {Key: "bIds", Value: primitive.A{
-			BIds[0],
-			BIds[1],
-			BIds[2],
-			BIds[3],
-		}}},
-		bson.D{{Key: "_id", Value: CIds[1]}, {Key: "aId", Value: AIds[1]}, {Key: "bIds", Value: primitive.A{
-			BIds[4],
-			BIds[5],
-			BIds[6],
-			BIds[7],
-			BIds[8],
-		}}},
-		bson.D{{Key: "_id", Value: CIds[2]}, {Key: "aId", Value: AIds[2]}, {Key: "bIds", Value: primitive.A{
-			BIds[9],
-			BIds[10],
-			BIds[11],
-			BIds[12],
-			BIds[13],
-		}}},
+// Seed fills the database of s with the documents it describes and returns how many were skipped
+// because their _id already existed. IDs come from the seed of s so seeding twice does not duplicate anything
+func Seed(ctx context.Context, client *mongo.Client, s *Spec, opts ...SeedOptionF) (int, error) {
+	o := &seedOptions{batchSize: defaultBatchSize}
+	for _, opt := range opts {
+		opt(o)
 	}
 
-	if _, err := A.InsertMany(ctx, As); err != nil {
-		log.Fatalf("Error during inserting: %s", err)
+	g, err := NewGenerator(s)
+	if err != nil {
+		return 0, err
 	}
-	if _, err := B.InsertMany(ctx, Bs); err != nil {
-		log.Fatalf("Error during inserting: %s", err)
+
+	if o.reset {
+		if err := Drop(ctx, client, s); err != nil {
+			return 0, err
+		}
 	}
-	if _, err := C.InsertMany(ctx, Cs); err != nil {
-		log.Fatalf("Error during inserting: %s", err)
+
+	sink := NewMongoSink(ctx, client.Database(s.Database), MongoSinkWithBatchSize(o.batchSize))
+	err = Run(g, sink)
+	return sink.Skipped(), err
+}
+
+// Drop drops the collections of s, the other collections of its database are left alone
+func Drop(ctx context.Context, client *mongo.Client, s *Spec) error {
+	d := client.Database(s.Database)
+	for _, c := range s.Collections {
+		if err := d.Collection(c.Name).Drop(ctx); err != nil {
+			return fmt.Errorf("Error during dropping %s.%s: %w", s.Database, c.Name, err)
+		}
 	}
 
-	fmt.Println("Database filled")
+	return nil
 }
@@ -0,0 +1,305 @@
+package seeder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flowHater/mongo-inferer/pkg/discover"
+	"github.com/flowHater/mongo-inferer/pkg/extjson"
+	"github.com/flowHater/mongo-inferer/pkg/inmem"
+	"github.com/flowHater/mongo-inferer/pkg/schema"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func loadSpec(t *testing.T, file string) *Spec {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	s, err := LoadSpec(f)
+	if err != nil {
+		t.Fatalf("LoadSpec() error = %v", err)
+	}
+
+	return s
+}
+
+func TestGenerator(t *testing.T) {
+	ctx := context.Background()
+	s := loadSpec(t, "testdata/shop.yaml")
+	g, err := NewGenerator(s)
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	f := inmem.New(0)
+	counts := map[string]int{}
+	byUser := map[interface{}]int{}
+	err = g.Generate(func(collection string, doc primitive.D) error {
+		counts[collection]++
+		f.Insert(s.Database, collection, doc.Map())
+
+		m := doc.Map()
+		if collection == "orders" {
+			byUser[m["userId"]]++
+			if _, ok := m["subjectType"].(string); !ok {
+				t.Errorf("order %v has no subjectType", m["_id"])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generator.Generate() error = %v", err)
+	}
+
+	if want := map[string]int{"users": 50, "teams": 5, "orders": 400}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("Generator.Generate() counts = %v, want %v", counts, want)
+	}
+
+	// With a zipf fan-out the most referenced user gets far more than the 8 orders of a uniform pick
+	max := 0
+	for _, n := range byUser {
+		if n > max {
+			max = n
+		}
+	}
+	if max < 40 {
+		t.Errorf("most referenced user has %d orders, want a skewed distribution", max)
+	}
+
+	d, err := discover.New(ctx, f)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, s.Database)
+	if err != nil {
+		t.Fatalf("Discover.Database() error = %v", err)
+	}
+
+	got := map[string][]string{}
+	for _, l := range links["orders"] {
+		got[l.Path] = l.With
+		sort.Strings(got[l.Path])
+	}
+	want := map[string][]string{
+		"userId":       {"shop.users"},
+		"legacyUserId": {"shop.users"},
+		"subject":      {"shop.teams", "shop.users"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("discovered links of orders = %v, want %v", got, want)
+	}
+}
+
+func TestGenerator_Deterministic(t *testing.T) {
+	generate := func(seed int64) []primitive.D {
+		s := loadSpec(t, "testdata/shop.yaml")
+		s.Seed = seed
+		g, err := NewGenerator(s)
+		if err != nil {
+			t.Fatalf("NewGenerator() error = %v", err)
+		}
+
+		docs := []primitive.D{}
+		if err := g.Generate(func(_ string, doc primitive.D) error {
+			docs = append(docs, doc)
+			return nil
+		}); err != nil {
+			t.Fatalf("Generator.Generate() error = %v", err)
+		}
+		return docs
+	}
+
+	first := generate(42)
+	if !reflect.DeepEqual(first, generate(42)) {
+		t.Errorf("Generator.Generate() gave different documents for the same seed")
+	}
+	if reflect.DeepEqual(first[0][0], generate(43)[0][0]) {
+		t.Errorf("Generator.Generate() gave the same _id for different seeds")
+	}
+}
+
+func TestExistingIDs(t *testing.T) {
+	dup := mongo.WriteError{Code: duplicateKey, Message: `E11000 duplicate key error collection: shop.users index: _id_ dup key: { _id: ObjectId('5f1d7f3e9b1e8a3c4c8b4567') }`}
+	unique := mongo.WriteError{Code: duplicateKey, Message: `E11000 duplicate key error collection: shop.users index: email_1 dup key: { email: "a@b.c" }`}
+	tests := []struct {
+		name   string
+		err    error
+		want   int
+		wantOK bool
+	}{
+		{"duplicates", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: dup}, {WriteError: dup}}}, 2, true},
+		{"wrapped", fmt.Errorf("insert: %w", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: dup}}}), 1, true},
+		{"other unique index", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: dup}, {WriteError: unique}}}, 0, false},
+		{"other code", mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: dup}, {WriteError: mongo.WriteError{Code: 2}}}}, 0, false},
+		{"write concern", mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 64}, WriteErrors: []mongo.BulkWriteError{{WriteError: dup}}}, 0, false},
+		{"other error", errors.New("connection refused"), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := existingIDs(tt.err)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("existingIDs() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSpec_Validate(t *testing.T) {
+	if err := DefaultSpec().Validate(); err != nil {
+		t.Errorf("DefaultSpec().Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"unknown target", "database: d\ncollections: [{name: a, count: 1, fields: [{name: x, type: ref, ref: [b]}]}]", "unknown collection b"},
+		{"reserved _id", "database: d\ncollections: [{name: a, count: 1, fields: [{name: _id, type: int}]}]", "empty or duplicated"},
+		{"array without items", "database: d\ncollections: [{name: a, count: 1, fields: [{name: x, type: array}]}]", "has no items"},
+		{"unknown type", "database: d\ncollections: [{name: a, count: 1, fields: [{name: x, type: uuid}]}]", "unknown type"},
+		{"unknown key", "database: d\ncollections: [{name: a, cnt: 1}]", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadSpec(strings.NewReader(tt.yaml))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadSpec() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecFromInference(t *testing.T) {
+	ctx := context.Background()
+	s := loadSpec(t, "testdata/shop.yaml")
+	g, err := NewGenerator(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := inmem.New(0)
+	err = g.Generate(func(collection string, doc primitive.D) error {
+		f.Insert(s.Database, collection, doc.Map())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	collector := schema.NewCollector()
+	d, err := discover.New(ctx, f, discover.WithSampleObserver(collector))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, s.Database)
+	if err != nil {
+		t.Fatalf("Discover.Database() error = %v", err)
+	}
+
+	inferred := SpecFromInference(s.Database, collector.Database(s.Database), links, 2)
+	g, err = NewGenerator(inferred)
+	if err != nil {
+		t.Fatalf("NewGenerator() of the inferred spec error = %v", err)
+	}
+
+	dir, err := ioutil.TempDir("", "seeder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sink, err := NewFileSink(dir, s.Database, FormatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(g, sink); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	d, err = discover.New(ctx, extjson.NewFetcher(dir, 0))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	lookAlike, err := d.Database(ctx, s.Database)
+	if err != nil {
+		t.Fatalf("Discover.Database() of the look-alike error = %v", err)
+	}
+
+	for c, cl := range links {
+		for p, l := range cl {
+			got, ok := lookAlike[c][p]
+			if !ok {
+				t.Errorf("look-alike misses the link %s.%s", c, p)
+				continue
+			}
+
+			sort.Strings(l.With)
+			sort.Strings(got.With)
+			if !reflect.DeepEqual(got.With, l.With) || math.Abs(float64(got.Avg-l.Avg)) > 0.15 {
+				t.Errorf("look-alike link %s.%s = %v %.2f, want %v %.2f", c, p, got.With, got.Avg, l.With, l.Avg)
+			}
+		}
+	}
+}
+
+func TestSpecFromInference_Values(t *testing.T) {
+	ctx := context.Background()
+	f := inmem.New(0)
+	emails := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		email := fmt.Sprintf("user%d@example.com", i)
+		emails[email] = true
+		status := "active"
+		if i%4 == 0 {
+			status = "banned"
+		}
+		f.Insert("shop", "users", primitive.M{"_id": primitive.NewObjectID(), "email": email, "status": status})
+	}
+
+	collector := schema.NewCollector()
+	d, err := discover.New(ctx, f, discover.WithSampleObserver(collector))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	links, err := d.Database(ctx, "shop")
+	if err != nil {
+		t.Fatalf("Discover.Database() error = %v", err)
+	}
+
+	g, err := NewGenerator(SpecFromInference("shop", collector.Database("shop"), links, 5))
+	if err != nil {
+		t.Fatalf("NewGenerator() error = %v", err)
+	}
+
+	statuses := map[string]bool{}
+	err = g.Generate(func(collection string, doc primitive.D) error {
+		m := doc.Map()
+		if email, _ := m["email"].(string); emails[email] {
+			return fmt.Errorf("sampled email %s was copied", email)
+		}
+		if status, ok := m["status"].(string); ok {
+			statuses[status] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if want := map[string]bool{"active": true, "banned": true}; !reflect.DeepEqual(statuses, want) {
+		t.Errorf("generated statuses = %v, want the sampled %v", statuses, want)
+	}
+}
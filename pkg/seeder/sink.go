@@ -0,0 +1,214 @@
+package seeder
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All the formats of a FileSink
+const (
+	// FormatBSON writes concatenated BSON documents, as mongodump does
+	FormatBSON = "bson"
+	// FormatNDJSON writes a canonical Extended JSON document per line, as mongoexport does
+	FormatNDJSON = "ndjson"
+)
+
+// Sink receives the generated documents
+type Sink interface {
+	Write(collection string, doc primitive.D) error
+	Close() error
+}
+
+// Run generates every document of g into s and closes s
+func Run(g *Generator, s Sink) error {
+	err := g.Generate(s.Write)
+	if cerr := s.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// MongoSink inserts documents into a database with InsertMany, a batch of documents at a time.
+// Documents whose _id already exists are skipped so seeding twice the same Spec inserts nothing the second time,
+// any other unique index violation is an error
+type MongoSink struct {
+	ctx        context.Context
+	db         *mongo.Database
+	batchSize  int
+	collection string
+	batch      []interface{}
+	skipped    int
+}
+
+// MongoSinkOptionF describes a func that will be called from the NewMongoSink func
+type MongoSinkOptionF func(*MongoSink)
+
+// MongoSinkWithBatchSize sets how many documents each InsertMany sends
+func MongoSinkWithBatchSize(n int) MongoSinkOptionF {
+	return func(s *MongoSink) {
+		s.batchSize = n
+	}
+}
+
+// NewMongoSink creates a MongoSink into db, ctx bounds every insertion
+func NewMongoSink(ctx context.Context, db *mongo.Database, opts ...MongoSinkOptionF) *MongoSink {
+	s := &MongoSink{ctx: ctx, db: db, batchSize: defaultBatchSize}
+
+	for _, o := range opts {
+		o(s)
+	}
+	if s.batchSize < 1 {
+		s.batchSize = 1
+	}
+
+	return s
+}
+
+// Write buffers doc and inserts the buffer when it's full or when the collection changes
+func (s *MongoSink) Write(collection string, doc primitive.D) error {
+	if collection != s.collection || len(s.batch) >= s.batchSize {
+		if err := s.flush(); err != nil {
+			return err
+		}
+		s.collection = collection
+	}
+
+	s.batch = append(s.batch, doc)
+	return nil
+}
+
+// Close inserts what is left in the buffer
+func (s *MongoSink) Close() error {
+	return s.flush()
+}
+
+// Skipped returns the number of documents not inserted because their _id already existed
+func (s *MongoSink) Skipped() int {
+	return s.skipped
+}
+
+func (s *MongoSink) flush() error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+
+	// Unordered so a document already there does not stop the rest of the batch
+	_, err := s.db.Collection(s.collection).InsertMany(s.ctx, s.batch, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		n, ok := existingIDs(err)
+		if !ok {
+			return fmt.Errorf("Error during inserting into %s.%s: %w", s.db.Name(), s.collection, err)
+		}
+		s.skipped += n
+	}
+	s.batch = s.batch[:0]
+
+	return nil
+}
+
+// duplicateKey is the server error code of a unique index violation
+const duplicateKey = 11000
+
+// primaryIndex is how the server names the index of the violated key in the message of a duplicate _id
+const primaryIndex = "index: _id_ "
+
+// existingIDs returns how many documents err tells already exist, false when err tells anything else,
+// like the violation of another unique index
+func existingIDs(err error) (int, bool) {
+	var bwe mongo.BulkWriteException
+	if !errors.As(err, &bwe) || bwe.WriteConcernError != nil || len(bwe.WriteErrors) == 0 {
+		return 0, false
+	}
+
+	for _, e := range bwe.WriteErrors {
+		if e.Code != duplicateKey || !strings.Contains(e.Message, primaryIndex) {
+			return 0, false
+		}
+	}
+
+	return len(bwe.WriteErrors), true
+}
+
+// FileSink writes a file per collection laid out as <dir>/<db>/<collection>.<bson|json>,
+// the layout read back by extjson.Fetcher for NDJSON
+type FileSink struct {
+	dir    string
+	format string
+	files  map[string]*os.File
+	writer map[string]*bufio.Writer
+}
+
+// NewFileSink creates a FileSink writing the collections of db in dir with format
+func NewFileSink(dir, db, format string) (*FileSink, error) {
+	if format != FormatBSON && format != FormatNDJSON {
+		return nil, fmt.Errorf("Unknown format %q, expected bson or ndjson", format)
+	}
+
+	d := filepath.Join(dir, db)
+	if err := os.MkdirAll(d, 0755); err != nil {
+		return nil, fmt.Errorf("Error during creating %s: %w", d, err)
+	}
+
+	return &FileSink{dir: d, format: format, files: map[string]*os.File{}, writer: map[string]*bufio.Writer{}}, nil
+}
+
+// Write appends doc to the file of collection
+func (s *FileSink) Write(collection string, doc primitive.D) error {
+	w, ok := s.writer[collection]
+	if !ok {
+		ext := ".bson"
+		if s.format == FormatNDJSON {
+			ext = ".json"
+		}
+
+		f, err := os.Create(filepath.Join(s.dir, collection+ext))
+		if err != nil {
+			return fmt.Errorf("Error during creating file of %s: %w", collection, err)
+		}
+
+		w = bufio.NewWriter(f)
+		s.files[collection] = f
+		s.writer[collection] = w
+	}
+
+	var b []byte
+	var err error
+	if s.format == FormatNDJSON {
+		b, err = bson.MarshalExtJSON(doc, true, false)
+		b = append(b, '\n')
+	} else {
+		b, err = bson.Marshal(doc)
+	}
+	if err != nil {
+		return fmt.Errorf("Error during encoding document of %s: %w", collection, err)
+	}
+
+	_, err = w.Write(b)
+	return err
+}
+
+// Close flushes and closes every file
+func (s *FileSink) Close() error {
+	var first error
+	for c, f := range s.files {
+		if err := s.writer[c].Flush(); err != nil && first == nil {
+			first = fmt.Errorf("Error during writing file of %s: %w", c, err)
+		}
+		if err := f.Close(); err != nil && first == nil {
+			first = fmt.Errorf("Error during closing file of %s: %w", c, err)
+		}
+	}
+
+	return first
+}
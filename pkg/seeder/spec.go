@@ -0,0 +1,202 @@
+package seeder
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+)
+
+// All the types a FieldSpec can generate
+const (
+	TypeObjectID = "objectId"
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeLong     = "long"
+	TypeDouble   = "double"
+	TypeBool     = "bool"
+	TypeDate     = "date"
+	TypeRef      = "ref"
+	TypeObject   = "object"
+	TypeArray    = "array"
+)
+
+// All the ways a reference picks its target
+const (
+	FanOutUniform = "uniform"
+	FanOutZipf    = "zipf"
+)
+
+// Spec describes a dataset to generate, it's read from YAML or JSON
+type Spec struct {
+	Database string `yaml:"database" json:"database"`
+	// Seed makes the generated values reproducible
+	Seed        int64            `yaml:"seed" json:"seed"`
+	Collections []CollectionSpec `yaml:"collections" json:"collections"`
+}
+
+// CollectionSpec describes the documents of a collection, every document gets an ObjectId _id
+type CollectionSpec struct {
+	Name   string      `yaml:"name" json:"name"`
+	Count  int         `yaml:"count" json:"count"`
+	Fields []FieldSpec `yaml:"fields" json:"fields"`
+}
+
+// FieldSpec describes the values of a field, or of the elements of an array when it's its Items
+type FieldSpec struct {
+	Name string `yaml:"name" json:"name"`
+	Type string `yaml:"type" json:"type"`
+	// Optional is the ratio of documents missing the field, Nullable the ratio of null values
+	Optional float64 `yaml:"optional" json:"optional"`
+	Nullable float64 `yaml:"nullable" json:"nullable"`
+
+	// Min and Max bound numbers, 0 and 1000 by default
+	Min float64 `yaml:"min" json:"min"`
+	Max float64 `yaml:"max" json:"max"`
+	// Values are the strings to pick from, random words otherwise
+	Values []string `yaml:"values" json:"values"`
+
+	// Ref are the collections a reference points to, more than one makes a polymorphic reference
+	Ref []string `yaml:"ref" json:"ref"`
+	// Discriminator is a sibling field receiving the collection a polymorphic reference points to
+	Discriminator string `yaml:"discriminator" json:"discriminator"`
+	// AsString writes references as hexadecimal strings instead of ObjectIds
+	AsString bool `yaml:"asString" json:"asString"`
+	// Dangling is the ratio of references to documents that do not exist
+	Dangling float64 `yaml:"dangling" json:"dangling"`
+	// FanOut is how targets are picked: uniform, or zipf so a few targets get most of the references.
+	// Skew sharpens the zipf distribution, it must be above 1 and is 1.2 by default
+	FanOut string  `yaml:"fanOut" json:"fanOut"`
+	Skew   float64 `yaml:"skew" json:"skew"`
+
+	// Fields are the fields of an object
+	Fields []FieldSpec `yaml:"fields" json:"fields"`
+	// Items describes the elements of an array and Length their number
+	Items  *FieldSpec `yaml:"items" json:"items"`
+	Length Range      `yaml:"length" json:"length"`
+}
+
+// Range is an inclusive range of integers
+type Range struct {
+	Min int `yaml:"min" json:"min"`
+	Max int `yaml:"max" json:"max"`
+}
+
+// LoadSpec reads and validates a Spec written in YAML or JSON
+func LoadSpec(r io.Reader) (*Spec, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Error during reading spec: %w", err)
+	}
+
+	s := &Spec{}
+	// JSON is valid YAML
+	if err := yaml.UnmarshalStrict(b, s); err != nil {
+		return nil, fmt.Errorf("Error during parsing spec: %w", err)
+	}
+
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Validate checks that s can be generated
+func (s *Spec) Validate() error {
+	if s.Database == "" {
+		return fmt.Errorf("Invalid spec: no database")
+	}
+
+	names := map[string]bool{}
+	for _, c := range s.Collections {
+		if c.Name == "" || names[c.Name] {
+			return fmt.Errorf("Invalid spec: collection name %q is empty or duplicated", c.Name)
+		}
+		if c.Count < 0 {
+			return fmt.Errorf("Invalid spec: negative count for %s", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	for _, c := range s.Collections {
+		if err := validateFields(c.Fields, c.Name, true, names); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateFields checks the fields of a document, top tells it's the root where _id is reserved
+func validateFields(fs []FieldSpec, path string, top bool, collections map[string]bool) error {
+	seen := map[string]bool{"_id": top}
+	for _, f := range fs {
+		p := path + "." + f.Name
+		if f.Name == "" || seen[f.Name] {
+			return fmt.Errorf("Invalid spec: field name %q of %s is empty or duplicated", f.Name, path)
+		}
+		seen[f.Name] = true
+
+		if f.Discriminator != "" {
+			if seen[f.Discriminator] {
+				return fmt.Errorf("Invalid spec: discriminator %s of %s is already a field", f.Discriminator, p)
+			}
+			seen[f.Discriminator] = true
+		}
+
+		if err := validateField(f, p, collections); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validateField(f FieldSpec, path string, collections map[string]bool) error {
+	if !ratio(f.Optional) || !ratio(f.Nullable) || !ratio(f.Dangling) {
+		return fmt.Errorf("Invalid spec: optional, nullable and dangling of %s must be ratios between 0 and 1", path)
+	}
+
+	switch f.Type {
+	case TypeObjectID, TypeString, TypeBool, TypeDate:
+	case TypeInt, TypeLong, TypeDouble:
+		if f.Max < f.Min {
+			return fmt.Errorf("Invalid spec: max of %s is lower than its min", path)
+		}
+	case TypeRef:
+		if len(f.Ref) == 0 {
+			return fmt.Errorf("Invalid spec: reference %s has no target", path)
+		}
+		for _, r := range f.Ref {
+			if !collections[r] {
+				return fmt.Errorf("Invalid spec: reference %s targets unknown collection %s", path, r)
+			}
+		}
+		if f.FanOut != "" && f.FanOut != FanOutUniform && f.FanOut != FanOutZipf {
+			return fmt.Errorf("Invalid spec: unknown fan-out %q of %s, expected uniform or zipf", f.FanOut, path)
+		}
+	case TypeObject:
+		return validateFields(f.Fields, path, false, collections)
+	case TypeArray:
+		if f.Items == nil {
+			return fmt.Errorf("Invalid spec: array %s has no items", path)
+		}
+		if f.Length.Min < 0 || f.Length.Max < f.Length.Min {
+			return fmt.Errorf("Invalid spec: invalid length of %s", path)
+		}
+		if f.Items.Discriminator != "" {
+			return fmt.Errorf("Invalid spec: the items of %s have no sibling to hold a discriminator", path)
+		}
+		return validateField(*f.Items, path+".$", collections)
+	default:
+		return fmt.Errorf("Invalid spec: unknown type %q of %s", f.Type, path)
+	}
+
+	return nil
+}
+
+func ratio(f float64) bool {
+	return f >= 0 && f <= 1
+}